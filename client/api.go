@@ -0,0 +1,36 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// FTLAPI is implemented by every backend of the client:
+// FTLClient for the socket API and APIClient for the Pi-hole v6 REST API.
+// Recorder decorates a backend and Fake serves in-memory responses
+type FTLAPI interface {
+	GetStats() (*Stats, error)
+	GetDBStats() (*DBStats, error)
+	GetTopDomains() (*Entries, error)
+	GetTopAds() (*Entries, error)
+	GetTopClients() (*Entries, error)
+	GetTopBlockedClients() (*Entries, error)
+	GetForwardDestinations() (*[]UpstreamDestination, error)
+	GetQueryTypes() (*map[string]float32, error)
+	GetQueriesOverTime() (*OverTime, error)
+	GetClientsOverTime() (*[]TimestampClients, error)
+	GetClientNames() (*[]Client, error)
+}
+
+var _ FTLAPI = (*FTLClient)(nil)
+var _ FTLAPI = (*APIClient)(nil)
+var _ FTLAPI = (*Recorder)(nil)
+var _ FTLAPI = (*Fake)(nil)
@@ -0,0 +1,220 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// APIClient for the REST API of Pi-hole v6. Logs in with the app password
+// and renews the session when it expires
+type APIClient struct {
+	baseURL  *url.URL
+	password string
+	client   *http.Client
+
+	mu       sync.Mutex
+	loggedIn bool
+	sid      string
+	validity time.Duration
+	expires  time.Time
+}
+
+// NewAPIClient creates the Pi-hole v6 REST API client for the address of
+// the web server, e.g. `http://pi.hole`. An empty password is used for
+// Pi-holes without authentication
+func NewAPIClient(address string, password string, client *http.Client) (*APIClient, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(address, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme of %s", address)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &APIClient{
+		baseURL:  baseURL,
+		password: password,
+		client:   client,
+	}, nil
+}
+
+type authResponse struct {
+	Session struct {
+		Valid    bool    `json:"valid"`
+		Sid      *string `json:"sid"`
+		Validity int     `json:"validity"`
+		Message  string  `json:"message"`
+	} `json:"session"`
+}
+
+// login creates a new session, the mutex has to be held
+func (client *APIClient) login() error {
+	body, err := json.Marshal(map[string]string{"password": client.password})
+	if err != nil {
+		return err
+	}
+
+	response, err := client.client.Post(client.url("/api/auth", nil), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer closeBody(response.Body)
+
+	if response.StatusCode == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("login failed: %s", response.Status)
+	}
+
+	var auth authResponse
+	if err := json.NewDecoder(response.Body).Decode(&auth); err != nil {
+		return err
+	}
+
+	if !auth.Session.Valid {
+		return fmt.Errorf("login failed: %s", auth.Session.Message)
+	}
+
+	client.sid = ""
+	if auth.Session.Sid != nil {
+		client.sid = *auth.Session.Sid
+	}
+	// validity is not positive for Pi-holes without authentication
+	client.loggedIn = true
+	client.validity = time.Duration(auth.Session.Validity) * time.Second
+	client.expires = time.Now().Add(client.validity)
+
+	return nil
+}
+
+// Logout ends the session
+func (client *APIClient) Logout() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.loggedIn = false
+	if client.sid == "" {
+		return nil
+	}
+
+	request, err := http.NewRequest(http.MethodDelete, client.url("/api/auth", nil), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-FTL-SID", client.sid)
+	client.sid = ""
+
+	response, err := client.client.Do(request)
+	if err != nil {
+		return err
+	}
+	closeBody(response.Body)
+
+	return nil
+}
+
+// closeBody closes the body of a response, a failure only loses the connection
+func closeBody(body io.Closer) {
+	if err := body.Close(); err != nil {
+		log.Println("Failed to close response body:", err)
+	}
+}
+
+func (client *APIClient) url(path string, query url.Values) string {
+	u := *client.baseURL
+	u.Path = u.Path + path
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// get requests the endpoint and decodes its JSON response into value.
+// The session is renewed once if the server does not accept it
+func (client *APIClient) get(path string, query url.Values, value interface{}) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if !client.loggedIn || (client.validity > 0 && time.Now().After(client.expires)) {
+		if err := client.login(); err != nil {
+			return err
+		}
+	}
+
+	body, err := client.do(path, query)
+	if err == errUnauthorized {
+		if err := client.login(); err != nil {
+			return err
+		}
+		body, err = client.do(path, query)
+	}
+	if err != nil {
+		return err
+	}
+	defer closeBody(body)
+
+	return json.NewDecoder(body).Decode(value)
+}
+
+func (client *APIClient) do(path string, query url.Values) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, client.url(path, query), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if client.sid != "" {
+		request.Header.Set("X-FTL-SID", client.sid)
+	}
+
+	response, err := client.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		// every request extends the session
+		client.expires = time.Now().Add(client.validity)
+
+		return response.Body, nil
+	case http.StatusUnauthorized:
+		closeBody(response.Body)
+
+		return nil, errUnauthorized
+	default:
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		closeBody(response.Body)
+
+		return nil, fmt.Errorf("%s: %s: %s", path, response.Status, strings.TrimSpace(string(message)))
+	}
+}
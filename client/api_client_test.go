@@ -0,0 +1,212 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+const testPassword = "app-password"
+
+// apiServer is a stand-in of the Pi-hole v6 REST API. Sessions are numbered,
+// the server accepts only the current one
+type apiServer struct {
+	logins  int32
+	expired int32
+	// notFound answers so many requests with 404 as a proxy during a restart
+	notFound int32
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/auth" && r.Method == http.MethodPost {
+		var auth struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&auth); err != nil || auth.Password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"session":{"valid":false,"sid":null,"validity":-1,"message":"password incorrect"}}`)
+
+			return
+		}
+
+		sid := atomic.AddInt32(&s.logins, 1)
+		atomic.StoreInt32(&s.expired, 0)
+		fmt.Fprintf(w, `{"session":{"valid":true,"sid":"sid-%d","validity":1800,"message":"password correct"}}`, sid)
+
+		return
+	}
+
+	if atomic.LoadInt32(&s.expired) == 1 || r.Header.Get("X-FTL-SID") != fmt.Sprintf("sid-%d", atomic.LoadInt32(&s.logins)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"key":"unauthorized","message":"Unauthorized"}}`)
+
+		return
+	}
+
+	if atomic.AddInt32(&s.notFound, -1) >= 0 {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/stats/summary":
+		fmt.Fprint(w, `{"queries":{"total":3214,"blocked":25,"percent_blocked":0.77784693,"unique_domains":3679,"forwarded":435,"cached":2754,"types":{"A":3000}},"clients":{"active":5,"total":7},"gravity":{"domains_being_blocked":94821,"last_update":1600000000}}`)
+	case "/api/dns/blocking":
+		fmt.Fprint(w, `{"blocking":"enabled","timer":null}`)
+	case "/api/stats/query_types":
+		fmt.Fprint(w, `{"types":{"A":75,"AAAA":25,"ANY":0}}`)
+	case "/api/stats/top_domains":
+		if r.URL.Query().Get("blocked") == "true" {
+			fmt.Fprint(w, `{"domains":[{"domain":"ads.example.com","count":20}],"total_queries":3214,"blocked_queries":25}`)
+		} else {
+			fmt.Fprint(w, `{"domains":[{"domain":"example.com","count":300},{"domain":"example.org","count":200}],"total_queries":3214,"blocked_queries":25}`)
+		}
+	case "/api/history/clients":
+		fmt.Fprint(w, `{"clients":{"192.168.1.3":{"name":"tv","total":4},"192.168.1.2":{"name":"laptop","total":6}},"history":[{"timestamp":1600000000,"data":{"192.168.1.2":6,"192.168.1.3":4}}]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestAPIClient(t *testing.T, password string) (*APIClient, *apiServer) {
+	handler := &apiServer{}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewAPIClient(server.URL, password, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, handler
+}
+
+func TestAPIClient_GetStats(t *testing.T) {
+	client, _ := newTestAPIClient(t, testPassword)
+
+	got, err := client.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Stats{
+		DomainsBeingBlocked: 94821,
+		DnsQueriesToday:     3214,
+		AdsBlockedToday:     25,
+		AdsPercentageToday:  0.77784693,
+		UniqueDomains:       3679,
+		QueriesForwarded:    435,
+		QueriesCached:       2754,
+		ClientsEverSeen:     7,
+		UniqueClients:       5,
+		Status:              1,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("GetStats() got = %v, want %v", got, want)
+	}
+}
+
+func TestAPIClient_wrongPassword(t *testing.T) {
+	client, _ := newTestAPIClient(t, "wrong")
+
+	if _, err := client.GetStats(); err == nil {
+		t.Error("GetStats() should fail to login")
+	}
+}
+
+func TestAPIClient_sessionRenewal(t *testing.T) {
+	client, server := newTestAPIClient(t, testPassword)
+
+	if _, err := client.GetQueryTypes(); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&server.expired, 1)
+	got, err := client.GetQueryTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.logins != 2 {
+		t.Errorf("logins = %d, want 2", server.logins)
+	}
+
+	want := &map[string]float32{"A": 75, "AAAA": 25, "ANY": 0}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("GetQueryTypes() got = %v, want %v", got, want)
+	}
+}
+
+func TestAPIClient_notFound(t *testing.T) {
+	client, server := newTestAPIClient(t, testPassword)
+	atomic.StoreInt32(&server.notFound, 1)
+
+	_, err := client.GetQueryTypes()
+	if err == nil {
+		t.Fatal("GetQueryTypes() should fail with 404")
+	}
+	if errors.Is(err, ErrUnsupported) {
+		t.Errorf("GetQueryTypes() err = %v, 404 is not an unsupported command", err)
+	}
+
+	if _, err := client.GetQueryTypes(); err != nil {
+		t.Errorf("GetQueryTypes() after 404: %v", err)
+	}
+}
+
+func TestAPIClient_GetTopAds(t *testing.T) {
+	client, _ := newTestAPIClient(t, testPassword)
+
+	got, err := client.GetTopAds()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Total.Value != 25 || len(got.List) != 1 || got.List[0].Entry != "ads.example.com" || got.List[0].Count != 20 {
+		t.Errorf("GetTopAds() got = %v", got)
+	}
+}
+
+func TestAPIClient_GetClientsOverTime(t *testing.T) {
+	client, _ := newTestAPIClient(t, testPassword)
+
+	clients, err := client.GetClientsOverTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := client.GetClientNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNames := &[]Client{{Name: "laptop", Address: "192.168.1.2"}, {Name: "tv", Address: "192.168.1.3"}}
+	if !reflect.DeepEqual(wantNames, names) {
+		t.Errorf("GetClientNames() got = %v, want %v", names, wantNames)
+	}
+
+	if len(*clients) != 1 || (*clients)[0].Timestamp != 1600000000 {
+		t.Fatalf("GetClientsOverTime() got = %v", clients)
+	}
+	if counts := (*clients)[0].Count; counts[0].Value != 6 || counts[1].Value != 4 {
+		t.Errorf("GetClientsOverTime() counts = %v, want [6 4]", counts)
+	}
+}
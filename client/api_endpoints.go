@@ -0,0 +1,342 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// topCount is the amount of entries requested for top lists,
+// it matches the default of the socket API
+const topCount = 10
+
+// GetStats retrieves engine statistics from `/api/stats/summary`
+// and blocking status from `/api/dns/blocking`
+func (client *APIClient) GetStats() (*Stats, error) {
+	var summary struct {
+		Queries struct {
+			Total          int     `json:"total"`
+			Blocked        int     `json:"blocked"`
+			PercentBlocked float32 `json:"percent_blocked"`
+			UniqueDomains  int     `json:"unique_domains"`
+			Forwarded      int     `json:"forwarded"`
+			Cached         int     `json:"cached"`
+		} `json:"queries"`
+		Clients struct {
+			Active int `json:"active"`
+			Total  int `json:"total"`
+		} `json:"clients"`
+		Gravity struct {
+			DomainsBeingBlocked int `json:"domains_being_blocked"`
+		} `json:"gravity"`
+	}
+	if err := client.get("/api/stats/summary", nil, &summary); err != nil {
+		return nil, err
+	}
+
+	var blocking struct {
+		Blocking string `json:"blocking"`
+	}
+	if err := client.get("/api/dns/blocking", nil, &blocking); err != nil {
+		return nil, err
+	}
+
+	status := 0
+	if blocking.Blocking == "enabled" {
+		status = 1
+	}
+
+	return &Stats{
+		DomainsBeingBlocked: summary.Gravity.DomainsBeingBlocked,
+		DnsQueriesToday:     summary.Queries.Total,
+		AdsBlockedToday:     summary.Queries.Blocked,
+		AdsPercentageToday:  summary.Queries.PercentBlocked,
+		UniqueDomains:       summary.Queries.UniqueDomains,
+		QueriesForwarded:    summary.Queries.Forwarded,
+		QueriesCached:       summary.Queries.Cached,
+		ClientsEverSeen:     summary.Clients.Total,
+		UniqueClients:       summary.Clients.Active,
+		Status:              status,
+	}, nil
+}
+
+// GetDBStats retrieves database statistics from `/api/info/database`
+func (client *APIClient) GetDBStats() (*DBStats, error) {
+	var database struct {
+		Size    uint64 `json:"size"`
+		Queries uint32 `json:"queries"`
+	}
+	if err := client.get("/api/info/database", nil, &database); err != nil {
+		return nil, err
+	}
+
+	var stats DBStats
+	stats.Rows.Value = database.Queries
+	stats.Size.Value = database.Size
+
+	return &stats, nil
+}
+
+// GetTopDomains retrieves the list of domains together with amount
+// of queries made for each domain from `/api/stats/top_domains`
+func (client *APIClient) GetTopDomains() (*Entries, error) {
+	return client.topDomainsFor(false)
+}
+
+// GetTopAds retrieves the list of ad domains together with amount
+// of queries made for each domain from `/api/stats/top_domains`
+func (client *APIClient) GetTopAds() (*Entries, error) {
+	return client.topDomainsFor(true)
+}
+
+func (client *APIClient) topDomainsFor(blocked bool) (*Entries, error) {
+	var top struct {
+		Domains []struct {
+			Domain string `json:"domain"`
+			Count  uint32 `json:"count"`
+		} `json:"domains"`
+		TotalQueries   uint32 `json:"total_queries"`
+		BlockedQueries uint32 `json:"blocked_queries"`
+	}
+	if err := client.get("/api/stats/top_domains", topQuery(blocked), &top); err != nil {
+		return nil, err
+	}
+
+	var result Entries
+	result.Total.Value = top.TotalQueries
+	if blocked {
+		result.Total.Value = top.BlockedQueries
+	}
+
+	for _, domain := range top.Domains {
+		result.List = append(result.List, struct {
+			Entry string
+			Count uint32
+		}{Entry: domain.Domain, Count: domain.Count})
+	}
+
+	return &result, nil
+}
+
+// GetTopClients retrieves the list of clients together with amount
+// of queries made by each client from `/api/stats/top_clients`
+func (client *APIClient) GetTopClients() (*Entries, error) {
+	return client.topClientsFor(false)
+}
+
+// GetTopBlockedClients retrieves the list of clients together with amount
+// of blocked queries made by each client from `/api/stats/top_clients`
+func (client *APIClient) GetTopBlockedClients() (*Entries, error) {
+	return client.topClientsFor(true)
+}
+
+func (client *APIClient) topClientsFor(blocked bool) (*Entries, error) {
+	var top struct {
+		Clients []struct {
+			IP    string `json:"ip"`
+			Name  string `json:"name"`
+			Count uint32 `json:"count"`
+		} `json:"clients"`
+		TotalQueries   uint32 `json:"total_queries"`
+		BlockedQueries uint32 `json:"blocked_queries"`
+	}
+	if err := client.get("/api/stats/top_clients", topQuery(blocked), &top); err != nil {
+		return nil, err
+	}
+
+	var result Entries
+	result.Total.Value = top.TotalQueries
+	if blocked {
+		result.Total.Value = top.BlockedQueries
+	}
+
+	for _, c := range top.Clients {
+		result.List = append(result.List, struct {
+			Entry string
+			Count uint32
+		}{Entry: c.IP, Count: c.Count})
+	}
+
+	return &result, nil
+}
+
+func topQuery(blocked bool) url.Values {
+	query := url.Values{}
+	query.Set("count", strconv.Itoa(topCount))
+	if blocked {
+		query.Set("blocked", "true")
+	}
+
+	return query
+}
+
+// GetForwardDestinations retrieves forward destinations with percentage
+// of queries forwarded to them from `/api/stats/upstreams`
+func (client *APIClient) GetForwardDestinations() (*[]UpstreamDestination, error) {
+	var upstreams struct {
+		Upstreams []struct {
+			IP    string `json:"ip"`
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		} `json:"upstreams"`
+		TotalQueries int `json:"total_queries"`
+	}
+	if err := client.get("/api/stats/upstreams", nil, &upstreams); err != nil {
+		return nil, err
+	}
+
+	var destinations []UpstreamDestination
+	for _, upstream := range upstreams.Upstreams {
+		destinations = append(destinations, UpstreamDestination{
+			Name:       upstream.Name,
+			Address:    upstream.IP,
+			Percentage: percentage(upstream.Count, upstreams.TotalQueries),
+		})
+	}
+
+	return &destinations, nil
+}
+
+// GetQueryTypes retrieves map with query type as keys and their percentages
+// among all queries as values from `/api/stats/query_types`
+func (client *APIClient) GetQueryTypes() (*map[string]float32, error) {
+	var types struct {
+		Types map[string]int `json:"types"`
+	}
+	if err := client.get("/api/stats/query_types", nil, &types); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, count := range types.Types {
+		total += count
+	}
+
+	queryTypes := make(map[string]float32)
+	for name, count := range types.Types {
+		queryTypes[name] = percentage(count, total)
+	}
+
+	return &queryTypes, nil
+}
+
+// GetQueriesOverTime retrieves amount of total and blocked queries
+// for the last 24 hours aggregated over 10 minute intervals from `/api/history`
+func (client *APIClient) GetQueriesOverTime() (*OverTime, error) {
+	var history struct {
+		History []struct {
+			Timestamp float64 `json:"timestamp"`
+			Total     uint32  `json:"total"`
+			Blocked   uint32  `json:"blocked"`
+		} `json:"history"`
+	}
+	if err := client.get("/api/history", nil, &history); err != nil {
+		return nil, err
+	}
+
+	var overTime OverTime
+	for _, slot := range history.History {
+		var forwarded, blocked TimestampCount
+		forwarded.Timestamp.Value = uint32(slot.Timestamp)
+		forwarded.Count.Value = slot.Total
+		blocked.Timestamp.Value = uint32(slot.Timestamp)
+		blocked.Count.Value = slot.Blocked
+
+		overTime.Forwarded = append(overTime.Forwarded, forwarded)
+		overTime.Blocked = append(overTime.Blocked, blocked)
+	}
+
+	return &overTime, nil
+}
+
+// clientsHistoryQuery requests all clients instead of the top ones only
+var clientsHistoryQuery = url.Values{"N": {"0"}}
+
+type clientsHistory struct {
+	Clients map[string]struct {
+		Name string `json:"name"`
+	} `json:"clients"`
+	History []struct {
+		Timestamp float64        `json:"timestamp"`
+		Data      map[string]int `json:"data"`
+	} `json:"history"`
+}
+
+// addresses returns the clients ordered by address, the order
+// matches the one of the counts in GetClientsOverTime
+func (h *clientsHistory) addresses() []string {
+	addresses := make([]string, 0, len(h.Clients))
+	for address := range h.Clients {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// GetClientsOverTime retrieves amount of queries grouped by client
+// for the last 24 hours aggregated over 10 minute intervals
+// from `/api/history/clients`
+func (client *APIClient) GetClientsOverTime() (*[]TimestampClients, error) {
+	var history clientsHistory
+	if err := client.get("/api/history/clients", clientsHistoryQuery, &history); err != nil {
+		return nil, err
+	}
+
+	addresses := history.addresses()
+
+	var timestamps []TimestampClients
+	for _, slot := range history.History {
+		clients := make([]Int32Block, len(addresses))
+		for i, address := range addresses {
+			clients[i].Value = int32(slot.Data[address])
+		}
+
+		timestamps = append(timestamps, TimestampClients{
+			Timestamp: uint32(slot.Timestamp),
+			Count:     clients,
+		})
+	}
+
+	return &timestamps, nil
+}
+
+// GetClientNames retrieves ordered list of client's names
+// from `/api/history/clients`
+func (client *APIClient) GetClientNames() (*[]Client, error) {
+	var history clientsHistory
+	if err := client.get("/api/history/clients", clientsHistoryQuery, &history); err != nil {
+		return nil, err
+	}
+
+	var clients []Client
+	for _, address := range history.addresses() {
+		clients = append(clients, Client{
+			Name:    history.Clients[address].Name,
+			Address: address,
+		})
+	}
+
+	return &clients, nil
+}
+
+func percentage(count int, total int) float32 {
+	if total == 0 {
+		return 0
+	}
+
+	return float32(count) * 100 / float32(total)
+}
@@ -13,22 +13,14 @@
 
 package client
 
-import (
-	"net"
-)
-
 // GetClientNames retrieves ordered list of client's names from
 // response of `>client-names` command
 func (client *FTLClient) GetClientNames() (*[]Client, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">client-names")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, ">client-names"); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var clients []Client
 	for {
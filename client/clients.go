@@ -15,7 +15,6 @@ package client
 
 import (
 	"encoding/binary"
-	"net"
 )
 
 // GetTopClients retrieves the list of clients together with amount of queries
@@ -31,15 +30,11 @@ func (client *FTLClient) GetTopBlockedClients() (*Entries, error) {
 }
 
 func topClientsFor(command string, client *FTLClient) (*Entries, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(command)
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, command); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var result Entries
 
@@ -15,8 +15,6 @@ package client
 
 import (
 	"encoding/binary"
-	"io"
-	"net"
 )
 
 // GetQueriesOverTime retrieves amount of queries grouped by client
@@ -24,24 +22,21 @@ import (
 // from response of `>ClientsoverTime` command
 // Warning: API might be not public
 func (client *FTLClient) GetClientsOverTime() (*[]TimestampClients, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">ClientsoverTime")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, ">ClientsoverTime"); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var timestamps []TimestampClients
 	for {
-		var format uint8
-		err := binary.Read(conn, binary.BigEndian, &format)
-
-		if err == io.EOF || format == formatEOF {
+		_, err := readFormat(conn)
+		if err == EOF {
 			break
 		}
+		if err != nil {
+			return nil, err
+		}
 
 		var clients []Int32Block
 
@@ -15,23 +15,22 @@ package client
 
 import (
 	"encoding/binary"
-	"net"
 )
 
 // GetDBStats retrieves database statistics from response of `>dbstats` command
 func (client *FTLClient) GetDBStats() (*DBStats, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">dbstats")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
+	defer conn.Close()
 
-	if err := sendCommand(conn, ">dbstats"); err != nil {
+	var stats DBStats
+	if err := binary.Read(conn, binary.BigEndian, &stats); err != nil {
 		return nil, err
 	}
 
-	var stats DBStats
-	if err := binary.Read(conn, binary.BigEndian, &stats); err != nil {
+	if err := readEOM(conn); err != nil {
 		return nil, err
 	}
 
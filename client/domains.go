@@ -15,7 +15,6 @@ package client
 
 import (
 	"encoding/binary"
-	"net"
 )
 
 // GetTopDomains retrieves the list of domains together with amount of queries
@@ -31,15 +30,11 @@ func (client *FTLClient) GetTopAds() (*Entries, error) {
 }
 
 func topQueriesFor(command string, client *FTLClient) (*Entries, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(command)
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, command); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var result Entries
 	if err := binary.Read(conn, binary.BigEndian, &result.Total); err != nil {
@@ -0,0 +1,149 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+)
+
+// ErrNoResponse is returned by Fake for the responses which are not set
+var ErrNoResponse = errors.New("no response configured")
+
+// Fake is an in-memory FTLAPI which returns the configured responses.
+// Err is returned by every method if set
+type Fake struct {
+	Stats               *Stats
+	DBStats             *DBStats
+	TopDomains          *Entries
+	TopAds              *Entries
+	TopClients          *Entries
+	TopBlockedClients   *Entries
+	ForwardDestinations *[]UpstreamDestination
+	QueryTypes          *map[string]float32
+	QueriesOverTime     *OverTime
+	ClientsOverTime     *[]TimestampClients
+	ClientNames         *[]Client
+	Err                 error
+}
+
+func (f *Fake) check(isSet bool) error {
+	if f.Err != nil {
+		return f.Err
+	}
+
+	if !isSet {
+		return ErrNoResponse
+	}
+
+	return nil
+}
+
+// GetStats implements FTLAPI.
+func (f *Fake) GetStats() (*Stats, error) {
+	if err := f.check(f.Stats != nil); err != nil {
+		return nil, err
+	}
+
+	return f.Stats, nil
+}
+
+// GetDBStats implements FTLAPI.
+func (f *Fake) GetDBStats() (*DBStats, error) {
+	if err := f.check(f.DBStats != nil); err != nil {
+		return nil, err
+	}
+
+	return f.DBStats, nil
+}
+
+// GetTopDomains implements FTLAPI.
+func (f *Fake) GetTopDomains() (*Entries, error) {
+	if err := f.check(f.TopDomains != nil); err != nil {
+		return nil, err
+	}
+
+	return f.TopDomains, nil
+}
+
+// GetTopAds implements FTLAPI.
+func (f *Fake) GetTopAds() (*Entries, error) {
+	if err := f.check(f.TopAds != nil); err != nil {
+		return nil, err
+	}
+
+	return f.TopAds, nil
+}
+
+// GetTopClients implements FTLAPI.
+func (f *Fake) GetTopClients() (*Entries, error) {
+	if err := f.check(f.TopClients != nil); err != nil {
+		return nil, err
+	}
+
+	return f.TopClients, nil
+}
+
+// GetTopBlockedClients implements FTLAPI.
+func (f *Fake) GetTopBlockedClients() (*Entries, error) {
+	if err := f.check(f.TopBlockedClients != nil); err != nil {
+		return nil, err
+	}
+
+	return f.TopBlockedClients, nil
+}
+
+// GetForwardDestinations implements FTLAPI.
+func (f *Fake) GetForwardDestinations() (*[]UpstreamDestination, error) {
+	if err := f.check(f.ForwardDestinations != nil); err != nil {
+		return nil, err
+	}
+
+	return f.ForwardDestinations, nil
+}
+
+// GetQueryTypes implements FTLAPI.
+func (f *Fake) GetQueryTypes() (*map[string]float32, error) {
+	if err := f.check(f.QueryTypes != nil); err != nil {
+		return nil, err
+	}
+
+	return f.QueryTypes, nil
+}
+
+// GetQueriesOverTime implements FTLAPI.
+func (f *Fake) GetQueriesOverTime() (*OverTime, error) {
+	if err := f.check(f.QueriesOverTime != nil); err != nil {
+		return nil, err
+	}
+
+	return f.QueriesOverTime, nil
+}
+
+// GetClientsOverTime implements FTLAPI.
+func (f *Fake) GetClientsOverTime() (*[]TimestampClients, error) {
+	if err := f.check(f.ClientsOverTime != nil); err != nil {
+		return nil, err
+	}
+
+	return f.ClientsOverTime, nil
+}
+
+// GetClientNames implements FTLAPI.
+func (f *Fake) GetClientNames() (*[]Client, error) {
+	if err := f.check(f.ClientNames != nil); err != nil {
+		return nil, err
+	}
+
+	return f.ClientNames, nil
+}
@@ -13,22 +13,14 @@
 
 package client
 
-import (
-	"net"
-)
-
 // GetForwardDestinations retrieves forward destination with amount
 // of queries forwarded to them from response of `>forward-dest` command
 func (client *FTLClient) GetForwardDestinations() (*[]UpstreamDestination, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">forward-dest")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, ">forward-dest"); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var destinations []UpstreamDestination
 	for {
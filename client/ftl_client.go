@@ -14,11 +14,14 @@
 package client
 
 import (
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
+	"time"
 )
 
 const (
@@ -28,15 +31,45 @@ const (
 	formatString  uint8 = 0xdb // 219
 	formatMap16   uint8 = 0xde // 222
 
+	formatUint16  uint8 = 0xcd // 205
+	formatInt64   uint8 = 0xd3 // 211
+	formatString8 uint8 = 0xd9 // 217
+	formatTrue    uint8 = 0xc3 // 195
+	formatFalse   uint8 = 0xc2 // 194
+
 	formatEOF uint8 = 0xc1 // 193
 )
 
+// sessionTimeout limits the time of a single command within a session
+const sessionTimeout = 30 * time.Second
+
+// unknownCommand starts the text FTL sends instead of values for unknown commands
+const unknownCommand = "unknown command"
+
+// ErrUnsupported is returned for the commands the FTL version does not know
+var ErrUnsupported = errors.New("unsupported command")
+
 var EOF = errors.New("EOF")
 var invalidFormat = errors.New("unexpected format")
+var incompleteResponse = errors.New("incomplete response")
+
+// Observer receives connection events of the client, e.g. for instrumentation
+type Observer interface {
+	// Dialed is called after every attempt to connect to the socket
+	Dialed(err error)
+	// Done is called when a response to the command has been read.
+	// The error is ErrUnsupported if FTL does not know the command
+	Done(command string, duration time.Duration, err error)
+}
 
 // FTLClient for Pi-holes's FTL daemon. Contains address to a unix socket
 type FTLClient struct {
-	addr *net.UnixAddr
+	addr     *net.UnixAddr
+	observer Observer
+	session  *session
+
+	recordDir  string
+	recordKeep int
 }
 
 // NewClient creates the Pi-hole's FTL engine client
@@ -62,18 +95,261 @@ func NewClient(socket string) (*FTLClient, error) {
 	}, nil
 }
 
-func readString(conn *net.UnixConn) (string, error) {
+// SetObserver sets the receiver of connection events
+func (client *FTLClient) SetObserver(observer Observer) {
+	client.observer = observer
+}
+
+// NewSession creates a client which keeps a single connection open for all
+// its commands. The connection is reestablished if FTL closes it after
+// a response. Session has to be closed after use and must not be shared
+// between goroutines
+func (client *FTLClient) NewSession() *FTLClient {
+	return &FTLClient{
+		addr:       client.addr,
+		observer:   client.observer,
+		session:    &session{},
+		recordDir:  client.recordDir,
+		recordKeep: client.recordKeep,
+	}
+}
+
+// Close ends the session. It is a no-op for a client without session
+func (client *FTLClient) Close() error {
+	if client.session == nil || client.session.conn == nil {
+		return nil
+	}
+
+	conn := client.session.conn
+	client.session.conn = nil
+	_ = sendCommand(conn, ">quit")
+
+	return conn.Close()
+}
+
+// session holds the connection shared by several commands
+type session struct {
+	conn   *net.UnixConn
+	reader *bufio.Reader
+}
+
+// connection reads a response to a single command
+type connection struct {
+	*bufio.Reader
+	client  *FTLClient
+	conn    *net.UnixConn
+	command string
+	begin   time.Time
+
+	// complete is set as soon as the end of the response is read
+	complete bool
+	// closed is set if FTL has closed the connection
+	closed bool
+	// unknown is set if FTL has answered that it does not know the command
+	unknown bool
+	// recorded holds the raw response if recording is enabled
+	recorded []byte
+}
+
+func (client *FTLClient) dial() (*net.UnixConn, error) {
+	conn, err := net.DialUnix("unix", nil, client.addr)
+	if client.observer != nil {
+		client.observer.Dialed(err)
+	}
+
+	return conn, err
+}
+
+// open sends the command and returns the connection to read the response from
+func (client *FTLClient) open(command string) (*connection, error) {
+	begin := time.Now()
+
+	c, err := client.send(command)
+	if err != nil {
+		if client.observer != nil {
+			client.observer.Done(command, time.Since(begin), err)
+		}
+
+		return nil, err
+	}
+	c.command = command
+	c.begin = begin
+
+	if c.unsupported() {
+		c.unknown = true
+		c.Close()
+
+		return nil, ErrUnsupported
+	}
+
+	return c, nil
+}
+
+// unsupported reports whether FTL answered with the text for unknown
+// commands and skips it up to the end of the response. The text cannot
+// be confused with values as no format byte is a printable character
+func (c *connection) unsupported() bool {
+	first, err := c.Reader.Peek(1)
+	if err != nil || first[0] != unknownCommand[0] {
+		return false
+	}
+
+	for {
+		b, err := c.ReadByte()
+		if err != nil {
+			break
+		}
+		if b == formatEOF {
+			c.complete = true
+
+			break
+		}
+	}
+
+	return true
+}
+
+func (client *FTLClient) send(command string) (*connection, error) {
+	if client.session == nil {
+		conn, err := client.dial()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := sendCommand(conn, command); err != nil {
+			closeConnection(conn)
+
+			return nil, err
+		}
+
+		return &connection{Reader: bufio.NewReader(conn), client: client, conn: conn}, nil
+	}
+
+	s := client.session
+	if s.conn != nil {
+		// FTL might have closed the connection after the previous response
+		if err := s.conn.SetDeadline(time.Now().Add(sessionTimeout)); err == nil {
+			if err := sendCommand(s.conn, command); err == nil {
+				if _, err := s.reader.Peek(1); err == nil {
+					return &connection{Reader: s.reader, client: client, conn: s.conn}, nil
+				}
+			}
+		}
+		closeConnection(s.conn)
+		s.conn = nil
+	}
+
+	conn, err := client.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(sessionTimeout)); err != nil {
+		closeConnection(conn)
+
+		return nil, err
+	}
+
+	if err := sendCommand(conn, command); err != nil {
+		closeConnection(conn)
+
+		return nil, err
+	}
+
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	return &connection{Reader: s.reader, client: client, conn: conn}, nil
+}
+
+// Read implements io.Reader and tracks whether FTL has closed the connection
+func (c *connection) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if err == io.EOF {
+		c.closed = true
+	}
+	if c.client.recordDir != "" {
+		c.recorded = append(c.recorded, p[:n]...)
+	}
+
+	return n, err
+}
+
+// ReadByte implements io.ByteReader, see Read
+func (c *connection) ReadByte() (byte, error) {
+	b, err := c.Reader.ReadByte()
+	if err == io.EOF {
+		c.closed = true
+	}
+	if err == nil && c.client.recordDir != "" {
+		c.recorded = append(c.recorded, b)
+	}
+
+	return b, err
+}
+
+// Close reports the command to the observer and closes the connection
+// unless it may be reused by the session
+func (c *connection) Close() {
+	if c.client.recordDir != "" {
+		c.record()
+	}
+
+	if c.client.observer != nil {
+		var err error
+		switch {
+		case c.unknown:
+			err = ErrUnsupported
+		case !c.complete:
+			err = incompleteResponse
+		}
+		c.client.observer.Done(c.command, time.Since(c.begin), err)
+	}
+
+	s := c.client.session
+	if s != nil && s.conn == c.conn && c.complete && !c.closed {
+		return
+	}
+
+	if s != nil && s.conn == c.conn {
+		s.conn = nil
+	}
+	closeConnection(c.conn)
+}
+
+// markEOM records that the end of the response has been read
+func markEOM(conn io.Reader) {
+	if c, ok := conn.(*connection); ok {
+		c.complete = true
+	}
+}
+
+// readFormat reads the format byte of the next value
+func readFormat(conn io.Reader) (uint8, error) {
 	var format uint8
 	if err := binary.Read(conn, binary.BigEndian, &format); err != nil {
 		if err == io.EOF {
-			return "", EOF
+			markEOM(conn)
+
+			return 0, EOF
 		}
 
-		return "", err
+		return 0, err
 	}
 
 	if format == formatEOF {
-		return "", EOF
+		markEOM(conn)
+
+		return 0, EOF
+	}
+
+	return format, nil
+}
+
+func readString(conn io.Reader) (string, error) {
+	format, err := readFormat(conn)
+	if err != nil {
+		return "", err
 	}
 
 	if format != formatString {
@@ -94,20 +370,12 @@ func readString(conn *net.UnixConn) (string, error) {
 	return string(value), nil
 }
 
-func readFloat32(conn *net.UnixConn) (float32, error) {
-	var format uint8
-	if err := binary.Read(conn, binary.BigEndian, &format); err != nil {
-		if err == io.EOF {
-			return 0.0, EOF
-		}
-
+func readFloat32(conn io.Reader) (float32, error) {
+	format, err := readFormat(conn)
+	if err != nil {
 		return 0.0, err
 	}
 
-	if format == formatEOF {
-		return 0.0, EOF
-	}
-
 	if format != formatFloat32 {
 		return 0.0, invalidFormat
 	}
@@ -120,20 +388,12 @@ func readFloat32(conn *net.UnixConn) (float32, error) {
 	return value, nil
 }
 
-func readUint32(conn *net.UnixConn) (uint32, error) {
-	var format uint8
-	if err := binary.Read(conn, binary.BigEndian, &format); err != nil {
-		if err == io.EOF {
-			return 0, EOF
-		}
-
+func readUint32(conn io.Reader) (uint32, error) {
+	format, err := readFormat(conn)
+	if err != nil {
 		return 0, err
 	}
 
-	if format == formatEOF {
-		return 0, EOF
-	}
-
 	if format != formatUint32 {
 		return 0, invalidFormat
 	}
@@ -146,7 +406,54 @@ func readUint32(conn *net.UnixConn) (uint32, error) {
 	return value, nil
 }
 
-func sendCommand(conn *net.UnixConn, command string) error {
+// readEOM skips the values left in the response up to its end.
+// It is used after the responses of fixed layout as FTL might
+// append fields unknown to the client
+func readEOM(conn io.Reader) error {
+	for {
+		format, err := readFormat(conn)
+		if err == EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var size int64
+		switch format {
+		case formatTrue, formatFalse:
+			size = 0
+		case formatUInt8:
+			size = 1
+		case formatUint16, formatMap16:
+			size = 2
+		case formatUint32, formatFloat32:
+			size = 4
+		case formatInt64:
+			size = 8
+		case formatString8:
+			var length uint8
+			if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+				return err
+			}
+			size = int64(length)
+		case formatString:
+			var length uint32
+			if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+				return err
+			}
+			size = int64(length)
+		default:
+			return invalidFormat
+		}
+
+		if _, err := io.CopyN(ioutil.Discard, conn, size); err != nil {
+			return err
+		}
+	}
+}
+
+func sendCommand(conn io.Writer, command string) error {
 	if _, err := conn.Write([]byte(command)); err != nil {
 		return err
 	}
@@ -155,8 +462,7 @@ func sendCommand(conn *net.UnixConn, command string) error {
 }
 
 func closeConnection(c io.Closer) {
-	err := c.Close()
-	if err != nil {
-		log.Fatal(err)
+	if err := c.Close(); err != nil {
+		log.Println("Failed to close FTL connection:", err)
 	}
 }
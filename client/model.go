@@ -13,6 +13,10 @@
 
 package client
 
+import (
+	"encoding/json"
+)
+
 // Stats represents the response of `>stats` command
 type Stats struct {
 	DomainsBeingBlocked int
@@ -38,26 +42,51 @@ type UInt32Block struct {
 	Value uint32
 }
 
+// MarshalJSON encodes the block as its value
+func (b UInt32Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Value)
+}
+
 type Int32Block struct {
 	_     uint8
 	Value int32
 }
 
+// MarshalJSON encodes the block as its value
+func (b Int32Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Value)
+}
+
 type UInt64Block struct {
 	_     uint8
 	Value uint64
 }
 
+// MarshalJSON encodes the block as its value
+func (b UInt64Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Value)
+}
+
 type UInt8Block struct {
 	_     uint8
 	Value uint8
 }
 
+// MarshalJSON encodes the block as its value
+func (b UInt8Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Value)
+}
+
 type Float32Block struct {
 	_     uint8
 	Value float32
 }
 
+// MarshalJSON encodes the block as its value
+func (b Float32Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Value)
+}
+
 type Entries struct {
 	Total UInt32Block
 	List  []struct {
@@ -95,3 +124,12 @@ type OverTime struct {
 	Forwarded []TimestampCount
 	Blocked   []TimestampCount
 }
+
+// Version represents the response of `>version` command
+type Version struct {
+	Version string
+	Tag     string
+	Branch  string
+	Hash    string
+	Date    string
+}
@@ -15,22 +15,17 @@ package client
 
 import (
 	"encoding/binary"
-	"net"
 )
 
 // GetQueriesOverTime retrieves amount of allowed and blocked queries
 // for the last 24 hours aggregated over 10 minute intervals
 // from response of `>overTime` command
 func (client *FTLClient) GetQueriesOverTime() (*OverTime, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">overTime")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, ">overTime"); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var lines struct {
 		_     uint8
@@ -56,6 +51,10 @@ func (client *FTLClient) GetQueriesOverTime() (*OverTime, error) {
 		return nil, err
 	}
 
+	if err := readEOM(conn); err != nil {
+		return nil, err
+	}
+
 	return &OverTime{
 		Forwarded: forwarded,
 		Blocked:   blocked,
@@ -13,22 +13,14 @@
 
 package client
 
-import (
-	"net"
-)
-
 // GetQueryTypes retrieves map with query type as keys and their percentages
 // among all queries as values from response of `>querytypes` command
 func (client *FTLClient) GetQueryTypes() (*map[string]float32, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">querytypes")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, ">querytypes"); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	queryTypes := make(map[string]float32)
 	for {
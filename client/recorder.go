@@ -0,0 +1,215 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRecordedCalls limits the history of the recorder
+const maxRecordedCalls = 100
+
+// Call is a single request recorded by Recorder
+type Call struct {
+	Method   string
+	Time     time.Time
+	Duration time.Duration
+	Result   interface{}
+	Err      error
+}
+
+// Recorder is FTLAPI decorator which records every call of the
+// wrapped backend together with its result
+type Recorder struct {
+	api FTLAPI
+	*history
+}
+
+// history holds the calls shared by the recorders of a backend and its sessions
+type history struct {
+	mu    sync.Mutex
+	calls []Call
+	last  map[string]Call
+}
+
+// NewRecorder wraps the backend with the recorder
+func NewRecorder(api FTLAPI) *Recorder {
+	return &Recorder{
+		api:     api,
+		history: &history{last: make(map[string]Call)},
+	}
+}
+
+// Backend returns the wrapped backend
+func (r *Recorder) Backend() FTLAPI {
+	return r.api
+}
+
+// With wraps another backend, e.g. a session of the wrapped one,
+// with the recorder sharing the recorded calls
+func (r *Recorder) With(api FTLAPI) *Recorder {
+	return &Recorder{
+		api:     api,
+		history: r.history,
+	}
+}
+
+// Calls returns the recent calls in order of their completion
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := make([]Call, len(r.calls))
+	copy(calls, r.calls)
+
+	return calls
+}
+
+// Last returns the last call of the method
+func (r *Recorder) Last(method string) (Call, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	call, ok := r.last[method]
+
+	return call, ok
+}
+
+// Reset forgets all recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+	r.last = make(map[string]Call)
+}
+
+func (r *Recorder) record(method string, begin time.Time, result interface{}, err error) {
+	call := Call{
+		Method:   method,
+		Time:     begin,
+		Duration: time.Since(begin),
+		Result:   result,
+		Err:      err,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.calls) >= maxRecordedCalls {
+		r.calls = r.calls[1:]
+	}
+	r.calls = append(r.calls, call)
+	r.last[method] = call
+}
+
+// GetStats implements FTLAPI.
+func (r *Recorder) GetStats() (*Stats, error) {
+	begin := time.Now()
+	result, err := r.api.GetStats()
+	r.record("GetStats", begin, result, err)
+
+	return result, err
+}
+
+// GetDBStats implements FTLAPI.
+func (r *Recorder) GetDBStats() (*DBStats, error) {
+	begin := time.Now()
+	result, err := r.api.GetDBStats()
+	r.record("GetDBStats", begin, result, err)
+
+	return result, err
+}
+
+// GetTopDomains implements FTLAPI.
+func (r *Recorder) GetTopDomains() (*Entries, error) {
+	begin := time.Now()
+	result, err := r.api.GetTopDomains()
+	r.record("GetTopDomains", begin, result, err)
+
+	return result, err
+}
+
+// GetTopAds implements FTLAPI.
+func (r *Recorder) GetTopAds() (*Entries, error) {
+	begin := time.Now()
+	result, err := r.api.GetTopAds()
+	r.record("GetTopAds", begin, result, err)
+
+	return result, err
+}
+
+// GetTopClients implements FTLAPI.
+func (r *Recorder) GetTopClients() (*Entries, error) {
+	begin := time.Now()
+	result, err := r.api.GetTopClients()
+	r.record("GetTopClients", begin, result, err)
+
+	return result, err
+}
+
+// GetTopBlockedClients implements FTLAPI.
+func (r *Recorder) GetTopBlockedClients() (*Entries, error) {
+	begin := time.Now()
+	result, err := r.api.GetTopBlockedClients()
+	r.record("GetTopBlockedClients", begin, result, err)
+
+	return result, err
+}
+
+// GetForwardDestinations implements FTLAPI.
+func (r *Recorder) GetForwardDestinations() (*[]UpstreamDestination, error) {
+	begin := time.Now()
+	result, err := r.api.GetForwardDestinations()
+	r.record("GetForwardDestinations", begin, result, err)
+
+	return result, err
+}
+
+// GetQueryTypes implements FTLAPI.
+func (r *Recorder) GetQueryTypes() (*map[string]float32, error) {
+	begin := time.Now()
+	result, err := r.api.GetQueryTypes()
+	r.record("GetQueryTypes", begin, result, err)
+
+	return result, err
+}
+
+// GetQueriesOverTime implements FTLAPI.
+func (r *Recorder) GetQueriesOverTime() (*OverTime, error) {
+	begin := time.Now()
+	result, err := r.api.GetQueriesOverTime()
+	r.record("GetQueriesOverTime", begin, result, err)
+
+	return result, err
+}
+
+// GetClientsOverTime implements FTLAPI.
+func (r *Recorder) GetClientsOverTime() (*[]TimestampClients, error) {
+	begin := time.Now()
+	result, err := r.api.GetClientsOverTime()
+	r.record("GetClientsOverTime", begin, result, err)
+
+	return result, err
+}
+
+// GetClientNames implements FTLAPI.
+func (r *Recorder) GetClientNames() (*[]Client, error) {
+	begin := time.Now()
+	result, err := r.api.GetClientNames()
+	r.record("GetClientNames", begin, result, err)
+
+	return result, err
+}
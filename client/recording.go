@@ -0,0 +1,104 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// CaptureExt is the extension of the files with raw responses
+	CaptureExt = ".bin"
+
+	// captureTimeFormat sorts the captures of a command in order of time
+	captureTimeFormat = "20060102T150405.000000000Z"
+)
+
+// SetRecordDir enables recording of every command and its raw response
+// into the directory, see CaptureName. Only the latest keep captures
+// of every command are kept, older ones are removed
+func (client *FTLClient) SetRecordDir(dir string, keep int) error {
+	if keep < 1 {
+		return fmt.Errorf("invalid number of captures to keep: %d", keep)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	client.recordDir = dir
+	client.recordKeep = keep
+
+	return nil
+}
+
+// CaptureName returns the name of the file with the raw response to the
+// command. The command is stored without the leading `>` and spaces are
+// replaced by `_`, the time of the capture is appended after `@` unless
+// it is zero, e.g. `top-clients_blocked@20201018T101502.000000000Z.bin`
+func CaptureName(command string, at time.Time) string {
+	name := strings.Replace(strings.TrimPrefix(command, ">"), " ", "_", -1)
+	if !at.IsZero() {
+		name += "@" + at.UTC().Format(captureTimeFormat)
+	}
+
+	return name + CaptureExt
+}
+
+// CaptureCommand returns the command of the capture file
+func CaptureCommand(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), CaptureExt)
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+
+	return ">" + strings.Replace(name, "_", " ", -1)
+}
+
+// record writes the raw response of the connection into the record directory
+func (c *connection) record() {
+	name := filepath.Join(c.client.recordDir, CaptureName(c.command, c.begin))
+	if err := ioutil.WriteFile(name, c.recorded, 0644); err != nil {
+		log.Println("Failed to record response:", err)
+
+		return
+	}
+
+	c.client.pruneCaptures(c.command)
+}
+
+// pruneCaptures removes the captures of the command except the latest ones.
+// The names of the captures sort in order of time
+func (client *FTLClient) pruneCaptures(command string) {
+	name := CaptureName(command, time.Time{})
+	pattern := strings.TrimSuffix(name, CaptureExt) + "@*" + CaptureExt
+	files, err := filepath.Glob(filepath.Join(client.recordDir, pattern))
+	if err != nil || len(files) <= client.recordKeep {
+		return
+	}
+	sort.Strings(files)
+
+	for _, file := range files[:len(files)-client.recordKeep] {
+		if err := os.Remove(file); err != nil {
+			log.Println("Failed to remove old capture:", err)
+		}
+	}
+}
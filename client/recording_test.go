@@ -0,0 +1,64 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnection_record(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client_record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &FTLClient{}
+	if err := client.SetRecordDir(dir, 0); err == nil {
+		t.Error("SetRecordDir() should fail without captures to keep")
+	}
+	if err := client.SetRecordDir(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Date(2020, 10, 18, 10, 15, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		for _, command := range []string{">top-clients", ">top-clients blocked"} {
+			c := &connection{client: client, command: command, begin: begin.Add(time.Duration(i) * time.Second)}
+			c.record()
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	want := []string{
+		"top-clients@20201018T101502.000000000Z.bin",
+		"top-clients@20201018T101503.000000000Z.bin",
+		"top-clients_blocked@20201018T101502.000000000Z.bin",
+		"top-clients_blocked@20201018T101503.000000000Z.bin",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("recorded files = %v, want %v", files, want)
+	}
+}
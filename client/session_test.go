@@ -0,0 +1,168 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sessionServer answers `>stats` commands. It keeps the connection
+// open for further commands unless closeAfterReply is set
+func sessionServer(t *testing.T, ln *net.UnixListener, closeAfterReply bool, accepted *int32) {
+	for {
+		c, err := ln.AcceptUnix()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(accepted, 1)
+
+		go func(c *net.UnixConn) {
+			defer c.Close()
+
+			buf := make([]byte, 512)
+			for {
+				nr, err := c.Read(buf)
+				if err != nil {
+					return
+				}
+
+				switch data := string(buf[0:nr]); data {
+				case ">stats":
+					if _, err := c.Write(stats); err != nil {
+						t.Error(err)
+
+						return
+					}
+				case ">quit":
+					return
+				default:
+					t.Errorf("Received unexpected command: %s", data)
+
+					return
+				}
+
+				if closeAfterReply {
+					return
+				}
+			}
+		}(c)
+	}
+}
+
+type countingObserver struct {
+	dials    int32
+	commands int32
+}
+
+func (o *countingObserver) Dialed(err error) {
+	atomic.AddInt32(&o.dials, 1)
+}
+
+func (o *countingObserver) Done(command string, duration time.Duration, err error) {
+	atomic.AddInt32(&o.commands, 1)
+}
+
+func TestSession(t *testing.T) {
+	for _, closeAfterReply := range []bool{false, true} {
+		socket := testUnixAddr()
+		addr, err := net.ResolveUnixAddr("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ln, err := net.ListenUnix("unix", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln.SetDeadline(time.Now().Add(someTimeout))
+
+		var accepted int32
+		go sessionServer(t, ln, closeAfterReply, &accepted)
+
+		observer := &countingObserver{}
+		client := &FTLClient{
+			addr:     addr,
+			observer: observer,
+		}
+		session := client.NewSession()
+
+		for i := 0; i < 3; i++ {
+			got, err := session.GetStats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.DomainsBeingBlocked != 94821 {
+				t.Errorf("GetStats() got = %v", got)
+			}
+		}
+
+		if err := session.Close(); err != nil {
+			t.Error(err)
+		}
+
+		wantDials := int32(1)
+		if closeAfterReply {
+			wantDials = 3
+		}
+		if observer.dials != wantDials {
+			t.Errorf("closeAfterReply = %v: dials = %d, want %d", closeAfterReply, observer.dials, wantDials)
+		}
+		if observer.commands != 3 {
+			t.Errorf("closeAfterReply = %v: commands = %d, want 3", closeAfterReply, observer.commands)
+		}
+
+		ln.Close()
+		os.Remove(socket)
+	}
+}
+
+func TestSession_brokenConnection(t *testing.T) {
+	socket := testUnixAddr()
+	addr, err := net.ResolveUnixAddr("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(socket)
+	defer ln.Close()
+	ln.SetDeadline(time.Now().Add(someTimeout))
+
+	var accepted int32
+	go sessionServer(t, ln, false, &accepted)
+
+	session := (&FTLClient{addr: addr}).NewSession()
+	defer session.Close()
+	if _, err := session.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deadline can't be set on the closed connection, the session dials again
+	session.session.conn.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := session.GetStats(); err != nil {
+			t.Errorf("GetStats() after broken connection: %v", err)
+		}
+	}
+	if accepted := atomic.LoadInt32(&accepted); accepted != 2 {
+		t.Errorf("accepted = %d, want 2", accepted)
+	}
+}
@@ -15,20 +15,15 @@ package client
 
 import (
 	"encoding/binary"
-	"net"
 )
 
 // GetStats retrieves engine statistics from response of `>stats` command
 func (client *FTLClient) GetStats() (*Stats, error) {
-	conn, err := net.DialUnix("unix", nil, client.addr)
+	conn, err := client.open(">stats")
 	if err != nil {
 		return nil, err
 	}
-	defer closeConnection(conn)
-
-	if err := sendCommand(conn, ">stats"); err != nil {
-		return nil, err
-	}
+	defer conn.Close()
 
 	var stats struct {
 		DomainsBeingBlocked UInt32Block
@@ -46,6 +41,10 @@ func (client *FTLClient) GetStats() (*Stats, error) {
 		return nil, err
 	}
 
+	if err := readEOM(conn); err != nil {
+		return nil, err
+	}
+
 	return &Stats{
 		DomainsBeingBlocked: int(stats.DomainsBeingBlocked.Value),
 		DnsQueriesToday:     int(stats.DnsQueriesToday.Value),
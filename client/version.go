@@ -0,0 +1,71 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// GetVersion retrieves the version of FTL from response of `>version` command
+func (client *FTLClient) GetVersion() (*Version, error) {
+	conn, err := client.open(">version")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var fields [5]string
+	for i := range fields {
+		if fields[i], err = readString(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := readEOM(conn); err != nil {
+		return nil, err
+	}
+
+	return &Version{
+		Version: fields[0],
+		Tag:     fields[1],
+		Branch:  fields[2],
+		Hash:    fields[3],
+		Date:    fields[4],
+	}, nil
+}
+
+// GetVersion retrieves the version of FTL from `/api/info/version`
+func (client *APIClient) GetVersion() (*Version, error) {
+	var info struct {
+		Version struct {
+			FTL struct {
+				Local struct {
+					Version string `json:"version"`
+					Branch  string `json:"branch"`
+					Hash    string `json:"hash"`
+					Date    string `json:"date"`
+				} `json:"local"`
+			} `json:"ftl"`
+		} `json:"version"`
+	}
+	if err := client.get("/api/info/version", nil, &info); err != nil {
+		return nil, err
+	}
+
+	local := info.Version.FTL.Local
+
+	return &Version{
+		Version: local.Version,
+		Tag:     local.Version,
+		Branch:  local.Branch,
+		Hash:    local.Hash,
+		Date:    local.Date,
+	}, nil
+}
@@ -25,6 +25,7 @@ type adDomainCollector struct {
 
 func init() {
 	registerCollector("ad_domains", defaultEnabled, newAdDomainCollector)
+	registerMethods("ad_domains", "GetTopAds")
 }
 
 func newAdDomainCollector() (Collector, error) {
@@ -43,7 +44,7 @@ func newAdDomainCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *adDomainCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *adDomainCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	queries, err := client.GetTopAds()
 	if err != nil {
 		return err
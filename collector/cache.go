@@ -0,0 +1,170 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheMaxStale time.Duration
+
+	errNotPolled = errors.New("collector has not been polled yet")
+
+	scrapeCacheAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_cache_age_seconds"),
+		"ftl_exporter: Age of the cached collector results.",
+		[]string{"collector"}, nil,
+	)
+)
+
+func init() {
+	flag.DurationVar(
+		&cacheMaxStale,
+		"collector.cache-max-stale",
+		10*time.Minute,
+		"How long the last good results of a cached collector are served while FTL fails (0 disables).")
+}
+
+// collectorCache keeps the last good results of a collector and reuses
+// them within the ttl. Results of a polled collector are refreshed
+// in background with the poll interval
+type collectorCache struct {
+	sync.Mutex
+	ttl      time.Duration
+	interval time.Duration
+	metrics  []prometheus.Metric
+	updated  time.Time
+
+	// result of the last background poll
+	err      error
+	duration time.Duration
+
+	// values of the last good poll to export the deltas of the next one
+	deltas bool
+	values map[string]pollValue
+}
+
+func newCollectorCache(ttl time.Duration, interval time.Duration) *collectorCache {
+	return &collectorCache{
+		ttl:      ttl,
+		interval: interval,
+		err:      errNotPolled,
+		deltas:   interval > 0 && pollDeltas,
+	}
+}
+
+// enabled reports whether the results are cached at all
+func (c *collectorCache) enabled() bool {
+	return c != nil && (c.ttl > 0 || c.interval > 0)
+}
+
+// polled reports whether the collector runs in background
+func (c *collectorCache) polled() bool {
+	return c != nil && c.interval > 0
+}
+
+// snapshot returns the results of the last background poll without running the collector
+func (c *collectorCache) snapshot(now time.Time) ([]prometheus.Metric, time.Duration, time.Duration, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.metrics == nil {
+		return nil, 0, c.duration, c.err
+	}
+
+	return c.metrics, now.Sub(c.updated), c.duration, c.err
+}
+
+// refresh runs the collector and stores its results. The last good results
+// are dropped if the collector keeps failing longer than max stale interval
+func (c *collectorCache) refresh(collector Collector, client client.FTLAPI, now time.Time) {
+	metrics, err := gather(collector, client)
+	duration := time.Since(now)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.err = err
+	c.duration = duration
+	if err == nil {
+		if c.deltas {
+			var deltas []prometheus.Metric
+			deltas, c.values = deltaMetrics(c.values, metrics)
+			metrics = append(metrics, deltas...)
+		}
+		c.metrics = metrics
+		c.updated = now
+	} else if now.Sub(c.updated) >= c.interval+cacheMaxStale {
+		c.metrics = nil
+	}
+}
+
+// get returns the cached results if they are younger than the ttl,
+// otherwise it runs the collector. The last good results are returned
+// together with the error if the collector fails within max stale interval
+func (c *collectorCache) get(collector Collector, client client.FTLAPI, now time.Time) ([]prometheus.Metric, time.Duration, error) {
+	if !c.enabled() {
+		metrics, err := gather(collector, client)
+
+		return metrics, 0, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.metrics != nil && now.Sub(c.updated) < c.ttl {
+		return c.metrics, now.Sub(c.updated), nil
+	}
+
+	metrics, err := gather(collector, client)
+	if err != nil {
+		if c.metrics != nil && now.Sub(c.updated) < c.ttl+cacheMaxStale {
+			return c.metrics, now.Sub(c.updated), err
+		}
+
+		return metrics, 0, err
+	}
+
+	c.metrics = metrics
+	c.updated = now
+
+	return metrics, 0, nil
+}
+
+// gather runs the collector and returns the metrics it produced
+func gather(c Collector, client client.FTLAPI) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+
+	var metrics []prometheus.Metric
+	go func() {
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		close(done)
+	}()
+
+	err := c.update(client, ch)
+	close(ch)
+	<-done
+
+	return metrics, err
+}
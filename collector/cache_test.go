@@ -0,0 +1,187 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var countingDesc = prometheus.NewDesc("ftl_test_updates", "Amount of updates.", nil, nil)
+
+type countingCollector struct {
+	updates int
+	err     error
+}
+
+func (c *countingCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	c.updates++
+	ch <- prometheus.MustNewConstMetric(countingDesc, prometheus.GaugeValue, float64(c.updates))
+
+	return nil
+}
+
+func TestCollectorCache_get(t *testing.T) {
+	collector := &countingCollector{}
+	cache := newCollectorCache(time.Minute, 0)
+	now := time.Now()
+
+	if _, _, err := cache.get(collector, nil, now); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, age, err := cache.get(collector, nil, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collector.updates != 1 || len(metrics) != 1 || age != 30*time.Second {
+		t.Errorf("get() within ttl: updates = %d, metrics = %d, age = %s", collector.updates, len(metrics), age)
+	}
+
+	if _, _, err := cache.get(collector, nil, now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if collector.updates != 2 {
+		t.Errorf("get() after ttl: updates = %d, want 2", collector.updates)
+	}
+
+	collector.err = errors.New("connection refused")
+	metrics, age, err = cache.get(collector, nil, now.Add(4*time.Minute))
+	if err == nil || len(metrics) != 1 || age != 2*time.Minute {
+		t.Errorf("get() stale: err = %v, metrics = %d, age = %s", err, len(metrics), age)
+	}
+
+	metrics, _, err = cache.get(collector, nil, now.Add(time.Hour))
+	if err == nil || len(metrics) != 0 {
+		t.Errorf("get() after max stale: err = %v, metrics = %d", err, len(metrics))
+	}
+}
+
+func TestCollectorCache_disabled(t *testing.T) {
+	collector := &countingCollector{}
+	cache := newCollectorCache(0, 0)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := cache.get(collector, nil, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if collector.updates != 2 {
+		t.Errorf("get() without cache: updates = %d, want 2", collector.updates)
+	}
+}
+
+func TestCollectorCache_refresh(t *testing.T) {
+	collector := &countingCollector{}
+	cache := newCollectorCache(0, time.Minute)
+	now := time.Now()
+
+	if _, _, _, err := cache.snapshot(now); err != errNotPolled {
+		t.Errorf("snapshot() before poll: err = %v, want %v", err, errNotPolled)
+	}
+
+	cache.refresh(collector, nil, now)
+	metrics, age, _, err := cache.snapshot(now.Add(10 * time.Second))
+	if err != nil || len(metrics) != 1 || age != 10*time.Second {
+		t.Errorf("snapshot() after poll: err = %v, metrics = %d, age = %s", err, len(metrics), age)
+	}
+
+	collector.err = errors.New("connection refused")
+	cache.refresh(collector, nil, now.Add(time.Minute))
+	metrics, _, _, err = cache.snapshot(now.Add(time.Minute))
+	if err == nil || len(metrics) != 1 {
+		t.Errorf("snapshot() after failed poll: err = %v, metrics = %d", err, len(metrics))
+	}
+
+	cache.refresh(collector, nil, now.Add(time.Hour))
+	metrics, _, _, err = cache.snapshot(now.Add(time.Hour))
+	if err == nil || len(metrics) != 0 {
+		t.Errorf("snapshot() after max stale: err = %v, metrics = %d", err, len(metrics))
+	}
+	if collector.updates != 1 {
+		t.Errorf("refresh() updates = %d, want 1", collector.updates)
+	}
+}
+
+func TestExporter_Polled(t *testing.T) {
+	exporter := Exporter{caches: map[string]*collectorCache{
+		"stats":   newCollectorCache(time.Minute, 0),
+		"domains": newCollectorCache(0, 0),
+	}}
+	if exporter.Polled() {
+		t.Error("Polled() = true without poll interval")
+	}
+
+	exporter.caches["clients"] = newCollectorCache(0, time.Minute)
+	if !exporter.Polled() {
+		t.Error("Polled() = false with poll interval")
+	}
+}
+
+// valuesCollector exports the counter of requests by client
+type valuesCollector struct {
+	requests map[string]float64
+}
+
+var requestsDesc = prometheus.NewDesc("ftl_test_requests_total", "Requests.", []string{"client"}, nil)
+
+func (c *valuesCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
+	for name, value := range c.requests {
+		ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, value, name)
+	}
+
+	return nil
+}
+
+func TestCollectorCache_deltas(t *testing.T) {
+	collector := &valuesCollector{requests: map[string]float64{"192.168.1.2": 10, "192.168.1.3": 5}}
+	cache := newCollectorCache(0, time.Minute)
+	cache.deltas = true
+	now := time.Now()
+
+	cache.refresh(collector, nil, now)
+	metrics, _, _, err := cache.snapshot(now)
+	if err != nil || len(metrics) != 2 {
+		t.Errorf("snapshot() after first poll: err = %v, metrics = %d, want no deltas", err, len(metrics))
+	}
+
+	// the counter of 192.168.1.3 has been reset, 192.168.1.4 is new
+	collector.requests = map[string]float64{"192.168.1.2": 25, "192.168.1.3": 2, "192.168.1.4": 1}
+	cache.refresh(collector, nil, now.Add(time.Minute))
+	metrics, _, _, err = cache.snapshot(now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP ftl_test_requests_total_poll_delta Change of ftl_test_requests_total since the previous poll.
+# TYPE ftl_test_requests_total_poll_delta gauge
+ftl_test_requests_total_poll_delta{client="192.168.1.2"} 15
+ftl_test_requests_total_poll_delta{client="192.168.1.3"} 2
+`
+	if err := testutil.CollectAndCompare(metricList(metrics), strings.NewReader(want), "ftl_test_requests_total_poll_delta"); err != nil {
+		t.Error(err)
+	}
+}
@@ -25,6 +25,7 @@ type clientCollector struct {
 
 func init() {
 	registerCollector("clients", defaultEnabled, newClientCollector)
+	registerMethods("clients", "GetTopClients", "GetTopBlockedClients")
 }
 
 func newClientCollector() (Collector, error) {
@@ -43,7 +44,7 @@ func newClientCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *clientCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *clientCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	clients, err := client.GetTopClients()
 	if err != nil {
 		return err
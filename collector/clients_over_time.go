@@ -28,6 +28,7 @@ func init() {
 	// command >ClientsoverTime is not in the official api
 	// it is disabled by default
 	registerCollector("clients_over_time", defaultDisabled, newClientsOverTimeCollector)
+	registerMethods("clients_over_time", "GetClientsOverTime", "GetClientNames")
 }
 
 func newClientsOverTimeCollector() (Collector, error) {
@@ -40,7 +41,7 @@ func newClientsOverTimeCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *clientsOverTimeCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *clientsOverTimeCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	clientsOverTime, err := client.GetClientsOverTime()
 	if err != nil {
 		return err
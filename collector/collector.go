@@ -23,8 +23,11 @@ import (
 )
 
 var (
-	factories      = make(map[string]func() (Collector, error))
-	collectorState = make(map[string]*bool)
+	factories         = make(map[string]func() (Collector, error))
+	collectorState    = make(map[string]*bool)
+	collectorCacheTTL = make(map[string]*time.Duration)
+	collectorPoll     = make(map[string]*time.Duration)
+	collectorMethods  = make(map[string][]string)
 )
 
 const (
@@ -65,20 +68,64 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func() (
 		flagUsage)
 	collectorState[collector] = &flagValue
 
+	var cacheTTL time.Duration
+	flag.DurationVar(
+		&cacheTTL,
+		fmt.Sprintf("collector.%s.cache-ttl", collector),
+		0,
+		fmt.Sprintf("Reuse results of the %s collector within this interval (0 disables caching).", collector))
+	collectorCacheTTL[collector] = &cacheTTL
+
+	var poll time.Duration
+	flag.DurationVar(
+		&poll,
+		fmt.Sprintf("collector.%s.poll-interval", collector),
+		0,
+		fmt.Sprintf("Poll the %s collector in background with this interval (default: --collector.poll-interval).", collector))
+	collectorPoll[collector] = &poll
+
 	factories[collector] = factory
 }
 
+// registerMethods records the client.FTLAPI methods the collector calls
+func registerMethods(collector string, methods ...string) {
+	collectorMethods[collector] = methods
+}
+
+// Methods returns the client.FTLAPI methods called by every collector
+// which uses FTL. Collectors reading other sources are not included
+func Methods() map[string][]string {
+	methods := make(map[string][]string)
+	for name, m := range collectorMethods {
+		methods[name] = append([]string(nil), m...)
+	}
+
+	return methods
+}
+
+// States returns whether every registered collector is enabled
+func States() map[string]bool {
+	states := make(map[string]bool)
+	for name, enabled := range collectorState {
+		states[name] = *enabled
+	}
+
+	return states
+}
+
 // Exporter represents exporter and has a link to the client
 type Exporter struct {
 	collectors map[string]Collector
-	client     *client.FTLClient
+	caches     map[string]*collectorCache
+	client     client.FTLAPI
+	observer   *clientObserver
+	support    *commandSupport
 }
 
-// NewExporter creates exporter using the provided socket path
-func NewExporter(socket string) (*Exporter, error) {
-	log.Printf("Initialize exporter using socket path: %s", socket)
-
+// NewExporter creates exporter using the provided FTL backend
+func NewExporter(api client.FTLAPI) (*Exporter, error) {
 	collectors := make(map[string]Collector)
+	caches := make(map[string]*collectorCache)
 	for key, enabled := range collectorState {
 		if *enabled {
 			collector, err := factories[key]()
@@ -89,17 +136,53 @@ func NewExporter(socket string) (*Exporter, error) {
 			log.Println("Collector", key, "is enabled")
 
 			collectors[key] = collector
+			interval := *collectorPoll[key]
+			if interval == 0 {
+				interval = pollInterval
+			}
+			caches[key] = newCollectorCache(*collectorCacheTTL[key], interval)
 		}
 	}
 
-	client, err := client.NewClient(socket)
-	if err != nil {
-		return nil, err
+	var observer *clientObserver
+	if socketClient, ok := socketBackend(api); ok {
+		observer = newClientObserver()
+		socketClient.SetObserver(observer)
+	}
+
+	return &Exporter{
+		collectors: collectors,
+		caches:     caches,
+		client:     api,
+		observer:   observer,
+		support:    newCommandSupport(),
+	}, nil
+}
+
+// Filter creates exporter sharing the client which runs only the named collectors.
+// Every name has to refer to a collector enabled at startup
+func (collector Exporter) Filter(names ...string) (*Exporter, error) {
+	collectors := make(map[string]Collector)
+	caches := make(map[string]*collectorCache)
+	for _, name := range names {
+		enabled, exist := collectorState[name]
+		if !exist {
+			return nil, fmt.Errorf("missing collector: %s", name)
+		}
+		if !*enabled {
+			return nil, fmt.Errorf("disabled collector: %s", name)
+		}
+
+		collectors[name] = collector.collectors[name]
+		caches[name] = collector.caches[name]
 	}
 
 	return &Exporter{
 		collectors: collectors,
-		client:     client,
+		caches:     caches,
+		client:     collector.client,
+		observer:   collector.observer,
+		support:    collector.support,
 	}, nil
 }
 
@@ -107,30 +190,106 @@ func NewExporter(socket string) (*Exporter, error) {
 func (collector Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeCacheAgeDesc
+	ch <- scrapeSupportedDesc
+	if collector.observer != nil {
+		collector.observer.Describe(ch)
+	}
 }
 
 // Collect implements the prometheus.Collector interface.
 func (collector Exporter) Collect(ch chan<- prometheus.Metric) {
+	// all collectors of the scrape share a single connection
+	session, closeSession := newSession(collector.client)
+	defer closeSession()
+
 	for name, c := range collector.collectors {
-		execute(name, c, collector.client, ch)
+		execute(name, c, collector.caches[name], collector.support, session, ch)
+	}
+
+	if collector.observer != nil {
+		collector.observer.Collect(ch)
 	}
 }
 
-func execute(name string, c Collector, client *client.FTLClient, ch chan<- prometheus.Metric) {
+func execute(name string, c Collector, cache *collectorCache, support *commandSupport, client client.FTLAPI, ch chan<- prometheus.Metric) {
+	var (
+		metrics  []prometheus.Metric
+		age      time.Duration
+		duration time.Duration
+		err      error
+	)
 	begin := time.Now()
-	err := c.update(client, ch)
-	duration := time.Since(begin)
+	switch {
+	case !support.supported(name):
+		// FTL has rejected the commands of the collector before
+	case cache.polled():
+		metrics, age, duration, err = cache.snapshot(begin)
+	default:
+		metrics, age, err = cache.get(c, client, begin)
+		duration = time.Since(begin)
+	}
+	// an unsupported collector does not fail the scrape
+	err = support.check(name, err)
+
+	for _, metric := range metrics {
+		ch <- metric
+	}
 
 	success := float64(1)
 	if err != nil {
+		log.Printf("Collector %s failed: %s", name, err)
 		success = 0
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+
+	supported := float64(1)
+	if !support.supported(name) {
+		supported = 0
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeSupportedDesc, prometheus.GaugeValue, supported, name)
+	if cache.enabled() {
+		ch <- prometheus.MustNewConstMetric(scrapeCacheAgeDesc, prometheus.GaugeValue, age.Seconds(), name)
+	}
+}
+
+// newSession returns the client keeping a single connection open
+// if the backend supports it and the function to close it
+func newSession(api client.FTLAPI) (client.FTLAPI, func()) {
+	socketClient, ok := socketBackend(api)
+	if !ok {
+		return api, func() {}
+	}
+
+	session := socketClient.NewSession()
+	closeSession := func() {
+		if err := session.Close(); err != nil {
+			log.Println("Failed to close FTL session:", err)
+		}
+	}
+
+	if recorder, ok := api.(*client.Recorder); ok {
+		return recorder.With(session), closeSession
+	}
+
+	return session, closeSession
+}
+
+// socketBackend returns the socket client of the backend
+// which may be wrapped by the recorder
+func socketBackend(api client.FTLAPI) (*client.FTLClient, bool) {
+	if recorder, ok := api.(*client.Recorder); ok {
+		api = recorder.Backend()
+	}
+
+	socketClient, ok := api.(*client.FTLClient)
+
+	return socketClient, ok
 }
 
 // Collector is the interface a collector has to implement.
 type Collector interface {
 	// Get new metrics and expose them via prometheus registry.
-	update(client *client.FTLClient, ch chan<- prometheus.Metric) error
+	update(client client.FTLAPI, ch chan<- prometheus.Metric) error
 }
@@ -0,0 +1,52 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestExporter_Filter(t *testing.T) {
+	stats, err := newStatsCollector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	domains, err := newDomainCollector()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := Exporter{
+		collectors: map[string]Collector{
+			"stats":   stats,
+			"domains": domains,
+		},
+	}
+
+	filtered, err := exporter.Filter("stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.collectors) != 1 || filtered.collectors["stats"] != stats {
+		t.Errorf("Filter() got = %v, want only stats collector", filtered.collectors)
+	}
+
+	if _, err := exporter.Filter("unknown"); err == nil {
+		t.Error("Filter() should fail for unknown collector")
+	}
+
+	if _, err := exporter.Filter("db_stats"); err == nil {
+		t.Error("Filter() should fail for disabled collector")
+	}
+}
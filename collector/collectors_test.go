@@ -0,0 +1,238 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/ftltest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testCollector adapts Collector to prometheus.Collector for the given backend
+type testCollector struct {
+	collector Collector
+	api       client.FTLAPI
+	err       error
+}
+
+func (c *testCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *testCollector) Collect(ch chan<- prometheus.Metric) {
+	c.err = c.collector.update(c.api, ch)
+}
+
+func TestCollectors(t *testing.T) {
+	api := ftltest.Fake()
+
+	tests := []struct {
+		name    string
+		factory func() (Collector, error)
+		want    string
+	}{
+		{
+			name:    "stats",
+			factory: newStatsCollector,
+			want: `
+# HELP ftl_ads_blocked_today Ads blocked today.
+# TYPE ftl_ads_blocked_today gauge
+ftl_ads_blocked_today 25
+# HELP ftl_ads_percentage_today Ads percentage today.
+# TYPE ftl_ads_percentage_today gauge
+ftl_ads_percentage_today 0.5
+# HELP ftl_clients_ever_seen Clients ever seen.
+# TYPE ftl_clients_ever_seen gauge
+ftl_clients_ever_seen 7
+# HELP ftl_dns_queries_today DNS Queries today.
+# TYPE ftl_dns_queries_today gauge
+ftl_dns_queries_today 3214
+# HELP ftl_domains_being_blocked Domains being blocked.
+# TYPE ftl_domains_being_blocked gauge
+ftl_domains_being_blocked 94821
+# HELP ftl_queries_cached_today Queries cached today.
+# TYPE ftl_queries_cached_today gauge
+ftl_queries_cached_today 2754
+# HELP ftl_queries_forwarded_today Queries forwarded today.
+# TYPE ftl_queries_forwarded_today gauge
+ftl_queries_forwarded_today 435
+# HELP ftl_status Blocking status.
+# TYPE ftl_status gauge
+ftl_status 1
+# HELP ftl_unique_clients Unique clients.
+# TYPE ftl_unique_clients gauge
+ftl_unique_clients 5
+# HELP ftl_unique_domains_today Unique domains seen today.
+# TYPE ftl_unique_domains_today gauge
+ftl_unique_domains_today 3679
+`,
+		},
+		{
+			name:    "db_stats",
+			factory: newDbStatsCollector,
+			want: `
+# HELP ftl_database_file_size Database file size.
+# TYPE ftl_database_file_size counter
+ftl_database_file_size 7.340032e+06
+# HELP ftl_queries_in_database Queries in database.
+# TYPE ftl_queries_in_database counter
+ftl_queries_in_database 123456
+`,
+		},
+		{
+			name:    "domains",
+			factory: newDomainCollector,
+			want: `
+# HELP ftl_top_domains_today Top domains today.
+# TYPE ftl_top_domains_today gauge
+ftl_top_domains_today{domain="example.com"} 300
+ftl_top_domains_today{domain="example.org"} 200
+# HELP ftl_total_domains_today Total domains today.
+# TYPE ftl_total_domains_today gauge
+ftl_total_domains_today 3214
+`,
+		},
+		{
+			name:    "ad_domains",
+			factory: newAdDomainCollector,
+			want: `
+# HELP ftl_top_ad_domains_today Top Ads today.
+# TYPE ftl_top_ad_domains_today gauge
+ftl_top_ad_domains_today{domain="ads.example.com"} 20
+# HELP ftl_total_ad_domains_today Overall ads.
+# TYPE ftl_total_ad_domains_today gauge
+ftl_total_ad_domains_today 25
+`,
+		},
+		{
+			name:    "clients",
+			factory: newClientCollector,
+			want: `
+# HELP ftl_top_blocked_clients_today Top blocked sources today.
+# TYPE ftl_top_blocked_clients_today gauge
+ftl_top_blocked_clients_today{client="192.168.1.3"} 15
+# HELP ftl_top_clients_today Top sources today.
+# TYPE ftl_top_clients_today gauge
+ftl_top_clients_today{client="192.168.1.2"} 2000
+`,
+		},
+		{
+			name:    "forward_destinations",
+			factory: newForwardDestinationCollector,
+			want: `
+# HELP ftl_forward_destinations_today Forward destinations today.
+# TYPE ftl_forward_destinations_today gauge
+ftl_forward_destinations_today{address="8.8.8.8"} 14.5
+ftl_forward_destinations_today{address="cache"} 85.5
+`,
+		},
+		{
+			name:    "query_types",
+			factory: newQueryTypesCollector,
+			want: `
+# HELP ftl_query_types_today DNS Query types today (percentage).
+# TYPE ftl_query_types_today gauge
+ftl_query_types_today{query="A (IPv4)"} 75
+ftl_query_types_today{query="AAAA (IPv6)"} 25
+`,
+		},
+		{
+			name:    "queries_over_time",
+			factory: newQueriesOverTimeCollector,
+			want: `
+# HELP ftl_queries_allowed Amount of allowed queries for the last 10 minutes.
+# TYPE ftl_queries_allowed gauge
+ftl_queries_allowed 12
+# HELP ftl_queries_blocked Amount blocked queries for the last 10 minutes.
+# TYPE ftl_queries_blocked gauge
+ftl_queries_blocked 2
+`,
+		},
+		{
+			name:    "clients_over_time",
+			factory: newClientsOverTimeCollector,
+			want: `
+# HELP ftl_clients Client requests for the last 10 minutes.
+# TYPE ftl_clients gauge
+ftl_clients{address="192.168.1.2"} 3
+ftl_clients{address="address_1"} 4
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector, err := tt.factory()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &testCollector{collector: collector, api: api}
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tt.want)); err != nil {
+				t.Error(err)
+			}
+			if c.err != nil {
+				t.Error(c.err)
+			}
+		})
+	}
+}
+
+func TestCollectors_recorder(t *testing.T) {
+	failure := errors.New("connection refused")
+	recorder := client.NewRecorder(&client.Fake{Err: failure})
+
+	collector, err := newClientCollector()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gather(collector, recorder); err != failure {
+		t.Errorf("update() err = %v, want %v", err, failure)
+	}
+
+	calls := recorder.Calls()
+	if len(calls) != 1 || calls[0].Method != "GetTopClients" || calls[0].Err != failure {
+		t.Errorf("Calls() got = %v, want single failed GetTopClients", calls)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	for name, want := range Methods() {
+		t.Run(name, func(t *testing.T) {
+			collector, err := factories[name]()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := client.NewRecorder(ftltest.Fake())
+			if _, err := gather(collector, recorder); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, call := range recorder.Calls() {
+				got = append(got, call.Method)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s collector calls %v, registered %v", name, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configSetupVars string
+	configFTLConf   string
+)
+
+// defaults of pihole-FTL.conf for the keys missing in the file
+var ftlConfDefaults = map[string]string{
+	"BLOCKINGMODE": blockingModeNull,
+	"PRIVACYLEVEL": "0",
+	"MAXDBDAYS":    "365",
+	"DBINTERVAL":   "1.0",
+}
+
+func init() {
+	registerCollector("config", defaultDisabled, newConfigCollector)
+
+	flag.StringVar(&configSetupVars, "collector.config.setup-vars", "/etc/pihole/setupVars.conf", "Path of setupVars.conf.")
+	flag.StringVar(&configFTLConf, "collector.config.ftl-conf", "/etc/pihole/pihole-FTL.conf", "Path of pihole-FTL.conf.")
+}
+
+// configCollector exposes the settings of setupVars.conf and pihole-FTL.conf
+type configCollector struct {
+	setupVars string
+	ftlConf   string
+
+	// invalid values are logged once for every change of pihole-FTL.conf
+	sync.Mutex
+	warned time.Time
+
+	info           *prometheus.Desc
+	upstream       *prometheus.Desc
+	privacyLevel   *prometheus.Desc
+	maxDBDays      *prometheus.Desc
+	dbInterval     *prometheus.Desc
+	blocking       *prometheus.Desc
+	lastChangeTime *prometheus.Desc
+}
+
+func newConfigCollector() (Collector, error) {
+	return newConfig(configSetupVars, configFTLConf), nil
+}
+
+func newConfig(setupVars string, ftlConf string) *configCollector {
+	return &configCollector{
+		setupVars: setupVars,
+		ftlConf:   ftlConf,
+
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "info"),
+			"Settings of Pi-hole as labels.",
+			[]string{"blocking_mode", "dnssec", "query_logging", "conditional_forwarding", "listening"}, nil,
+		),
+
+		upstream: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "upstream_info"),
+			"Upstream DNS servers configured in Pi-hole.",
+			[]string{"server"}, nil,
+		),
+
+		privacyLevel: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "privacy_level"),
+			"PRIVACYLEVEL of FTL.",
+			nil, nil,
+		),
+
+		maxDBDays: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "max_db_days"),
+			"MAXDBDAYS of FTL, how long queries are kept in the database.",
+			nil, nil,
+		),
+
+		dbInterval: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "db_interval_seconds"),
+			"DBINTERVAL of FTL, how often queries are stored in the database.",
+			nil, nil,
+		),
+
+		blocking: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "blocking_enabled"),
+			"Whether blocking is enabled in setupVars.conf.",
+			nil, nil,
+		),
+
+		lastChangeTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "last_change_timestamp_seconds"),
+			"Time of the last change of the configuration files.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *configCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	setupVars, setupVarsChanged, err := readConfigFile(c.setupVars)
+	if err != nil {
+		return err
+	}
+
+	// pihole-FTL.conf exists only if a setting differs from the defaults
+	ftlConf, ftlConfChanged, err := readConfigFile(c.ftlConf)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for key, value := range ftlConfDefaults {
+		if ftlConf[key] == "" {
+			ftlConf[key] = value
+		}
+	}
+
+	conditionalForwarding := "false"
+	if setupVars["CONDITIONAL_FORWARDING"] == "true" || setupVars["REV_SERVER"] == "true" {
+		conditionalForwarding = "true"
+	}
+	ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1,
+		strings.ToUpper(ftlConf["BLOCKINGMODE"]),
+		setupVars["DNSSEC"],
+		setupVars["QUERY_LOGGING"],
+		conditionalForwarding,
+		setupVars["DNSMASQ_LISTENING"],
+	)
+
+	for _, server := range configUpstreams(setupVars) {
+		ch <- prometheus.MustNewConstMetric(c.upstream, prometheus.GaugeValue, 1, server)
+	}
+
+	values := []struct {
+		desc  *prometheus.Desc
+		key   string
+		scale float64
+	}{
+		{c.privacyLevel, "PRIVACYLEVEL", 1},
+		{c.maxDBDays, "MAXDBDAYS", 1},
+		// DBINTERVAL is given in minutes
+		{c.dbInterval, "DBINTERVAL", 60},
+	}
+	c.Lock()
+	warn := !ftlConfChanged.Equal(c.warned)
+	c.warned = ftlConfChanged
+	c.Unlock()
+	for _, v := range values {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.GaugeValue, c.number(ftlConf, v.key, warn)*v.scale)
+	}
+
+	blocking := float64(1)
+	if setupVars["BLOCKING_ENABLED"] == "false" {
+		blocking = 0
+	}
+	ch <- prometheus.MustNewConstMetric(c.blocking, prometheus.GaugeValue, blocking)
+
+	changed := setupVarsChanged
+	if ftlConfChanged.After(changed) {
+		changed = ftlConfChanged
+	}
+	ch <- prometheus.MustNewConstMetric(c.lastChangeTime, prometheus.GaugeValue, float64(changed.UnixNano())/1e9)
+
+	return nil
+}
+
+// number returns the numeric setting of pihole-FTL.conf. FTL uses the
+// default for a value it can't parse, so does the collector
+func (c *configCollector) number(ftlConf map[string]string, key string, warn bool) float64 {
+	value, err := strconv.ParseFloat(ftlConf[key], 64)
+	if err == nil {
+		return value
+	}
+
+	if warn {
+		log.Printf("Invalid %s in %s, the default %s is used: %s", key, c.ftlConf, ftlConfDefaults[key], err)
+	}
+	value, _ = strconv.ParseFloat(ftlConfDefaults[key], 64)
+
+	return value
+}
+
+// configUpstreams returns the servers of PIHOLE_DNS_1, PIHOLE_DNS_2 and so on
+func configUpstreams(setupVars map[string]string) []string {
+	var keys []int
+	for key, value := range setupVars {
+		if !strings.HasPrefix(key, "PIHOLE_DNS_") || value == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(key, "PIHOLE_DNS_")); err == nil {
+			keys = append(keys, n)
+		}
+	}
+	sort.Ints(keys)
+
+	servers := make([]string, len(keys))
+	for i, n := range keys {
+		servers[i] = setupVars[fmt.Sprintf("PIHOLE_DNS_%d", n)]
+	}
+
+	return servers
+}
+
+// readConfigFile parses the `KEY=VALUE` lines of the file
+// and returns them with the modification time of the file
+func readConfigFile(path string) (map[string]string, time.Time, error) {
+	values := make(map[string]string)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return values, time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return values, time.Time{}, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		values[strings.TrimSpace(line[:i])] = strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+	}
+
+	return values, info.ModTime(), scanner.Err()
+}
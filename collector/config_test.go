@@ -0,0 +1,126 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConfigCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"setupVars.conf": `PIHOLE_INTERFACE=eth0
+QUERY_LOGGING=true
+BLOCKING_ENABLED=true
+DNSMASQ_LISTENING=local
+PIHOLE_DNS_1=8.8.8.8
+PIHOLE_DNS_2=1.1.1.1
+PIHOLE_DNS_10=9.9.9.9
+DNSSEC=false
+REV_SERVER=true
+`,
+	})
+	setupVars := filepath.Join(dir, "setupVars.conf")
+	ftlConf := filepath.Join(dir, "pihole-FTL.conf")
+	if err := os.Chtimes(setupVars, time.Unix(1603000000, 0), time.Unix(1603000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testCollector{collector: newConfig(setupVars, ftlConf)}
+
+	want := `
+# HELP ftl_config_blocking_enabled Whether blocking is enabled in setupVars.conf.
+# TYPE ftl_config_blocking_enabled gauge
+ftl_config_blocking_enabled 1
+# HELP ftl_config_db_interval_seconds DBINTERVAL of FTL, how often queries are stored in the database.
+# TYPE ftl_config_db_interval_seconds gauge
+ftl_config_db_interval_seconds %interval
+# HELP ftl_config_info Settings of Pi-hole as labels.
+# TYPE ftl_config_info gauge
+ftl_config_info{blocking_mode="%mode",conditional_forwarding="true",dnssec="false",listening="local",query_logging="true"} 1
+# HELP ftl_config_last_change_timestamp_seconds Time of the last change of the configuration files.
+# TYPE ftl_config_last_change_timestamp_seconds gauge
+ftl_config_last_change_timestamp_seconds %changed
+# HELP ftl_config_max_db_days MAXDBDAYS of FTL, how long queries are kept in the database.
+# TYPE ftl_config_max_db_days gauge
+ftl_config_max_db_days %days
+# HELP ftl_config_privacy_level PRIVACYLEVEL of FTL.
+# TYPE ftl_config_privacy_level gauge
+ftl_config_privacy_level %privacy
+# HELP ftl_config_upstream_info Upstream DNS servers configured in Pi-hole.
+# TYPE ftl_config_upstream_info gauge
+ftl_config_upstream_info{server="1.1.1.1"} 1
+ftl_config_upstream_info{server="8.8.8.8"} 1
+ftl_config_upstream_info{server="9.9.9.9"} 1
+`
+	// the defaults are used without pihole-FTL.conf
+	defaults := strings.NewReplacer("%interval", "60", "%mode", "NULL", "%changed", "1.603e+09", "%days", "365", "%privacy", "0")
+	if err := testutil.CollectAndCompare(c, strings.NewReader(defaults.Replace(want))); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+
+	writeFiles(t, dir, map[string]string{
+		"pihole-FTL.conf": "# FTL settings\nBLOCKINGMODE=nxdomain\nPRIVACYLEVEL=2\nMAXDBDAYS=\"90\"\nDBINTERVAL=0.5\n",
+	})
+	if err := os.Chtimes(ftlConf, time.Unix(1603001000, 0), time.Unix(1603001000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.NewReplacer("%interval", "30", "%mode", "NXDOMAIN", "%changed", "1.603001e+09", "%days", "90", "%privacy", "2")
+	if err := testutil.CollectAndCompare(c, strings.NewReader(changed.Replace(want))); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+	// empty and invalid values fall back to the defaults like in FTL
+	writeFiles(t, dir, map[string]string{
+		"pihole-FTL.conf": "BLOCKINGMODE=\nPRIVACYLEVEL=\nMAXDBDAYS=forever\nDBINTERVAL=0.5\n",
+	})
+	if err := os.Chtimes(ftlConf, time.Unix(1603002000, 0), time.Unix(1603002000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	invalid := strings.NewReplacer("%interval", "30", "%mode", "NULL", "%changed", "1.603002e+09", "%days", "365", "%privacy", "0")
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	for i := 0; i < 2; i++ {
+		if err := testutil.CollectAndCompare(c, strings.NewReader(invalid.Replace(want))); err != nil {
+			t.Error(err)
+		}
+		if c.err != nil {
+			t.Error(c.err)
+		}
+	}
+	// the invalid value is logged once until the file changes
+	if warnings := strings.Count(logged.String(), "Invalid MAXDBDAYS"); warnings != 1 {
+		t.Errorf("logged %d warnings, want 1:\n%s", warnings, logged.String())
+	}
+}
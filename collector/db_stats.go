@@ -27,6 +27,7 @@ func init() {
 	// >dbstats request may take some time for processing in case of a large database file
 	// it is disabled by default
 	registerCollector("db_stats", defaultDisabled, newDbStatsCollector)
+	registerMethods("db_stats", "GetDBStats")
 }
 
 func newDbStatsCollector() (Collector, error) {
@@ -45,7 +46,7 @@ func newDbStatsCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *dbStatsCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *dbStatsCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	dbStats, err := client.GetDBStats()
 	if err != nil {
 		return err
@@ -0,0 +1,319 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dhcpLeases         string
+	dhcpSetupVars      string
+	dhcpExpiringWithin time.Duration
+	dhcpLeaseInfo      string
+	dhcpHashKeyFile    string
+)
+
+// modes of the per-lease metrics
+const (
+	leaseInfoNone   = "none"
+	leaseInfoHashed = "hashed"
+	leaseInfoFull   = "full"
+)
+
+func init() {
+	registerCollector("dhcp", defaultDisabled, newDHCPCollector)
+
+	flag.StringVar(&dhcpLeases, "collector.dhcp.leases", "/etc/pihole/dhcp.leases", "Path of the dnsmasq lease file.")
+	flag.StringVar(&dhcpSetupVars, "collector.dhcp.setup-vars", "/etc/pihole/setupVars.conf", "Path of setupVars.conf with the DHCP range.")
+	flag.DurationVar(&dhcpExpiringWithin, "collector.dhcp.expiring-within", time.Hour, "Leases expiring within this interval are counted as expiring soon.")
+	flag.StringVar(
+		&dhcpLeaseInfo,
+		"collector.dhcp.lease-info",
+		leaseInfoNone,
+		"Per-lease metrics: none, hashed (MAC and hostname are hashed, the IP and IAID labels stay in clear text) or full.")
+	flag.StringVar(
+		&dhcpHashKeyFile,
+		"collector.dhcp.hash-key-file",
+		"",
+		"File with the secret key of the hashed lease info, a random key is generated at startup if empty, so the hashes change with every restart.")
+}
+
+// dhcpLease is a line of the lease file of dnsmasq. DHCPv6 leases have
+// the IAID instead of the MAC
+type dhcpLease struct {
+	expiry   time.Time
+	mac      string
+	iaid     string
+	ip       net.IP
+	hostname string
+}
+
+type dhcpCollector struct {
+	leases         string
+	setupVars      string
+	expiringWithin time.Duration
+	leaseInfo      string
+	hashKey        []byte
+	now            func() time.Time
+
+	enabled     *prometheus.Desc
+	active      *prometheus.Desc
+	expiring    *prometheus.Desc
+	poolSize    *prometheus.Desc
+	utilization *prometheus.Desc
+	leaseExpiry *prometheus.Desc
+}
+
+func newDHCPCollector() (Collector, error) {
+	hashKey, err := readHashKey(dhcpHashKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDHCP(dhcpLeases, dhcpSetupVars, dhcpExpiringWithin, dhcpLeaseInfo, hashKey)
+}
+
+func newDHCP(leases string, setupVars string, expiringWithin time.Duration, leaseInfo string, hashKey []byte) (*dhcpCollector, error) {
+	switch leaseInfo {
+	case leaseInfoNone, leaseInfoFull:
+	case leaseInfoHashed:
+		if len(hashKey) == 0 {
+			return nil, fmt.Errorf("empty hash key of dhcp")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported lease info of dhcp: %s", leaseInfo)
+	}
+
+	return &dhcpCollector{
+		leases:         leases,
+		setupVars:      setupVars,
+		expiringWithin: expiringWithin,
+		leaseInfo:      leaseInfo,
+		hashKey:        hashKey,
+		now:            time.Now,
+
+		enabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dhcp", "enabled"),
+			"Whether the DHCP server of Pi-hole is enabled.",
+			nil, nil,
+		),
+
+		active: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dhcp", "active_leases"),
+			"Leases which have not expired.",
+			nil, nil,
+		),
+
+		expiring: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dhcp", "expiring_leases"),
+			"Active leases expiring soon.",
+			nil, nil,
+		),
+
+		poolSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dhcp", "pool_size"),
+			"Addresses in the DHCP range.",
+			nil, nil,
+		),
+
+		utilization: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dhcp", "pool_utilization_ratio"),
+			"Ratio of the addresses in the DHCP range with an active lease.",
+			nil, nil,
+		),
+
+		leaseExpiry: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dhcp", "lease_expiry_timestamp_seconds"),
+			"Expiry time of the active lease, 0 for infinite leases.",
+			[]string{"ip", "mac", "iaid", "hostname"}, nil,
+		),
+	}, nil
+}
+
+func (c *dhcpCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	setupVars, _, err := readConfigFile(c.setupVars)
+	if err != nil {
+		return err
+	}
+
+	// the file is created when the DHCP server hands out the first lease
+	leases, err := readDHCPLeases(c.leases)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	enabled := float64(0)
+	if setupVars["DHCP_ACTIVE"] == "true" {
+		enabled = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.enabled, prometheus.GaugeValue, enabled)
+
+	start := ipv4Value(setupVars["DHCP_START"])
+	end := ipv4Value(setupVars["DHCP_END"])
+	inPool := start > 0 && end >= start
+
+	now := c.now()
+	var active, expiring, used float64
+	for _, lease := range leases {
+		infinite := lease.expiry.IsZero()
+		if !infinite && !lease.expiry.After(now) {
+			continue
+		}
+
+		active++
+		if !infinite && lease.expiry.Sub(now) <= c.expiringWithin {
+			expiring++
+		}
+		if ip := ipv4Value(lease.ip.String()); inPool && ip >= start && ip <= end {
+			used++
+		}
+
+		if c.leaseInfo != leaseInfoNone {
+			expiry := float64(0)
+			if !infinite {
+				expiry = float64(lease.expiry.Unix())
+			}
+			mac, hostname := lease.mac, lease.hostname
+			if c.leaseInfo == leaseInfoHashed {
+				mac, hostname = c.hashIdentifier(mac), c.hashIdentifier(hostname)
+			}
+			ch <- prometheus.MustNewConstMetric(c.leaseExpiry, prometheus.GaugeValue, expiry, lease.ip.String(), mac, lease.iaid, hostname)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, active)
+	ch <- prometheus.MustNewConstMetric(c.expiring, prometheus.GaugeValue, expiring)
+
+	if inPool {
+		size := float64(end - start + 1)
+		ch <- prometheus.MustNewConstMetric(c.poolSize, prometheus.GaugeValue, size)
+		ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, used/size)
+	}
+
+	return nil
+}
+
+// ipv4Value returns the IPv4 address as a number or 0 if it is not one
+func ipv4Value(address string) uint32 {
+	ip := net.ParseIP(address).To4()
+	if ip == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(ip)
+}
+
+// readHashKey returns the content of the key file or a random key
+// if the path is empty
+func readHashKey(path string) ([]byte, error) {
+	if path == "" {
+		key := make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	}
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s: empty hash key", path)
+	}
+
+	return key, nil
+}
+
+// hashIdentifier returns a pseudonym of the MAC or the hostname, which is
+// keyed, so it can't be reversed by hashing all the MACs of a vendor
+func (c *dhcpCollector) hashIdentifier(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// readDHCPLeases parses the lines `<expiry> <mac> <ip> <hostname> <client id>`
+// of the lease file, the expiry is 0 for infinite leases and the unknown
+// hostname is `*`. The DHCPv6 leases follow the `duid` line of the server
+// and have the IAID in place of the MAC
+func readDHCPLeases(path string) ([]dhcpLease, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var leases []dhcpLease
+	v6 := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "duid" {
+			v6 = true
+
+			continue
+		}
+		if len(fields) < 4 {
+			continue
+		}
+
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ip := net.ParseIP(fields[2])
+		if ip == nil {
+			return nil, fmt.Errorf("%s: invalid address %q", path, fields[2])
+		}
+
+		lease := dhcpLease{ip: ip}
+		if v6 {
+			lease.iaid = fields[1]
+		} else {
+			lease.mac = fields[1]
+		}
+		if expiry != 0 {
+			lease.expiry = time.Unix(expiry, 0)
+		}
+		if fields[3] != "*" {
+			lease.hostname = fields[3]
+		}
+		leases = append(leases, lease)
+	}
+
+	return leases, scanner.Err()
+}
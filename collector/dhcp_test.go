@@ -0,0 +1,149 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDHCPCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_dhcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// now is 1603000000, one lease expires within the hour,
+	// one has expired and one is outside of the range, the
+	// DHCPv6 lease after the duid line has an IAID
+	writeFiles(t, dir, map[string]string{
+		"setupVars.conf": "DHCP_ACTIVE=true\nDHCP_START=192.168.1.100\nDHCP_END=192.168.1.199\nDHCP_LEASETIME=24\n",
+		"dhcp.leases": `1603080000 aa:bb:cc:dd:ee:01 192.168.1.100 laptop 01:aa:bb:cc:dd:ee:01
+1603001800 aa:bb:cc:dd:ee:02 192.168.1.101 * *
+1602990000 aa:bb:cc:dd:ee:03 192.168.1.102 phone *
+0 aa:bb:cc:dd:ee:04 192.168.1.10 printer *
+duid 00:01:00:01:27:00:00:00:aa:bb:cc:dd:ee:00
+1603080000 305419896 fd00::100 tablet 00:01:00:01:27:00:00:00:aa:bb:cc:dd:ee:05
+`,
+	})
+
+	collector, err := newDHCP(filepath.Join(dir, "dhcp.leases"), filepath.Join(dir, "setupVars.conf"), time.Hour, leaseInfoFull, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.now = func() time.Time { return time.Unix(1603000000, 0) }
+	c := &testCollector{collector: collector}
+
+	want := `
+# HELP ftl_dhcp_active_leases Leases which have not expired.
+# TYPE ftl_dhcp_active_leases gauge
+ftl_dhcp_active_leases 4
+# HELP ftl_dhcp_enabled Whether the DHCP server of Pi-hole is enabled.
+# TYPE ftl_dhcp_enabled gauge
+ftl_dhcp_enabled 1
+# HELP ftl_dhcp_expiring_leases Active leases expiring soon.
+# TYPE ftl_dhcp_expiring_leases gauge
+ftl_dhcp_expiring_leases 1
+# HELP ftl_dhcp_lease_expiry_timestamp_seconds Expiry time of the active lease, 0 for infinite leases.
+# TYPE ftl_dhcp_lease_expiry_timestamp_seconds gauge
+ftl_dhcp_lease_expiry_timestamp_seconds{hostname="",iaid="",ip="192.168.1.101",mac="aa:bb:cc:dd:ee:02"} 1.6030018e+09
+ftl_dhcp_lease_expiry_timestamp_seconds{hostname="laptop",iaid="",ip="192.168.1.100",mac="aa:bb:cc:dd:ee:01"} 1.60308e+09
+ftl_dhcp_lease_expiry_timestamp_seconds{hostname="printer",iaid="",ip="192.168.1.10",mac="aa:bb:cc:dd:ee:04"} 0
+ftl_dhcp_lease_expiry_timestamp_seconds{hostname="tablet",iaid="305419896",ip="fd00::100",mac=""} 1.60308e+09
+# HELP ftl_dhcp_pool_size Addresses in the DHCP range.
+# TYPE ftl_dhcp_pool_size gauge
+ftl_dhcp_pool_size 100
+# HELP ftl_dhcp_pool_utilization_ratio Ratio of the addresses in the DHCP range with an active lease.
+# TYPE ftl_dhcp_pool_utilization_ratio gauge
+ftl_dhcp_pool_utilization_ratio 0.02
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+
+	// hashed identifiers hide the MAC and the hostname
+	collector.leaseInfo = leaseInfoHashed
+	hashed := strings.NewReplacer(
+		`hostname="laptop"`, `hostname="`+collector.hashIdentifier("laptop")+`"`,
+		`hostname="printer"`, `hostname="`+collector.hashIdentifier("printer")+`"`,
+		`hostname="tablet"`, `hostname="`+collector.hashIdentifier("tablet")+`"`,
+		"aa:bb:cc:dd:ee:01", collector.hashIdentifier("aa:bb:cc:dd:ee:01"),
+		"aa:bb:cc:dd:ee:02", collector.hashIdentifier("aa:bb:cc:dd:ee:02"),
+		"aa:bb:cc:dd:ee:04", collector.hashIdentifier("aa:bb:cc:dd:ee:04"),
+	)
+	leases := "# HELP ftl_dhcp_lease_expiry" + strings.Split(strings.Split(want, "# HELP ftl_dhcp_lease_expiry")[1], "# HELP ftl_dhcp_pool_size")[0]
+	if err := testutil.CollectAndCompare(c, strings.NewReader(hashed.Replace(leases)), "ftl_dhcp_lease_expiry_timestamp_seconds"); err != nil {
+		t.Error(err)
+	}
+	if got := collector.hashIdentifier("laptop"); len(got) != 16 {
+		t.Errorf("hashIdentifier() got = %s", got)
+	}
+
+	// the pseudonyms depend on the key
+	other, err := newDHCP("", "", time.Hour, leaseInfoHashed, []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.hashIdentifier("laptop") == collector.hashIdentifier("laptop") {
+		t.Error("hashIdentifier() should depend on the key")
+	}
+
+	if _, err := newDHCP("", "", time.Hour, "macs", nil); err == nil {
+		t.Error("newDHCP() should fail for unsupported lease info")
+	}
+	if _, err := newDHCP("", "", time.Hour, leaseInfoHashed, nil); err == nil {
+		t.Error("newDHCP() should fail for hashed lease info without a key")
+	}
+}
+
+func TestReadHashKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_dhcp_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{"key": "secret\n", "empty": "\n"})
+
+	key, err := readHashKey(filepath.Join(dir, "key"))
+	if err != nil || string(key) != "secret" {
+		t.Errorf("readHashKey() got = %q, %v", key, err)
+	}
+	if _, err := readHashKey(filepath.Join(dir, "empty")); err == nil {
+		t.Error("readHashKey() should fail for an empty key")
+	}
+
+	// random keys are generated without a file
+	first, err := readHashKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := readHashKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) == 0 || string(first) == string(second) {
+		t.Errorf("readHashKey() got = %x and %x, want random keys", first, second)
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	dnsProbeServer        string
+	dnsProbeNames         string
+	dnsProbeTypes         string
+	dnsProbeProtocols     string
+	dnsProbeTimeout       time.Duration
+	dnsProbeBlockedDomain string
+	dnsProbeBlockingMode  string
+	dnsProbeBlockingIP    string
+)
+
+// blocking modes of Pi-hole, see BLOCKINGMODE of pihole-FTL.conf
+const (
+	blockingModeNull         = "NULL"
+	blockingModeIPNodataAAAA = "IP-NODATA-AAAA"
+	blockingModeIP           = "IP"
+	blockingModeNXDomain     = "NXDOMAIN"
+	blockingModeNodata       = "NODATA"
+)
+
+var dnsProbeQueryTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"PTR":   dnsmessage.TypePTR,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+func init() {
+	// the probe sends real queries to the resolver,
+	// it is disabled by default
+	registerCollector("dns_probe", defaultDisabled, newDNSProbeCollector)
+
+	flag.StringVar(&dnsProbeServer, "collector.dns_probe.server", "127.0.0.1:53", "Address of the Pi-hole resolver to probe.")
+	flag.StringVar(&dnsProbeNames, "collector.dns_probe.names", "pi.hole", "Comma separated names to resolve.")
+	flag.StringVar(&dnsProbeTypes, "collector.dns_probe.types", "A", "Comma separated query types, e.g. A,AAAA.")
+	flag.StringVar(&dnsProbeProtocols, "collector.dns_probe.protocols", "udp", "Comma separated protocols: udp, tcp.")
+	flag.DurationVar(&dnsProbeTimeout, "collector.dns_probe.timeout", 2*time.Second, "Timeout of a single query.")
+	flag.StringVar(
+		&dnsProbeBlockedDomain,
+		"collector.dns_probe.blocked-domain",
+		"",
+		"Domain on the blocklist to check the blocking with (empty disables the check).")
+	flag.StringVar(
+		&dnsProbeBlockingMode,
+		"collector.dns_probe.blocking-mode",
+		blockingModeNull,
+		"BLOCKINGMODE of Pi-hole which defines the expected answer: NULL, IP-NODATA-AAAA, IP, NXDOMAIN or NODATA.")
+	flag.StringVar(
+		&dnsProbeBlockingIP,
+		"collector.dns_probe.blocking-ip",
+		"",
+		"IPv4 address of Pi-hole answered for blocked domains in the IP and IP-NODATA-AAAA blocking modes.")
+}
+
+// dnsProbeConcurrency limits the probe queries in flight
+const dnsProbeConcurrency = 16
+
+// dnsProbeConfig defines the queries of the probe
+type dnsProbeConfig struct {
+	server        string
+	names         []string
+	types         []string
+	protocols     []string
+	timeout       time.Duration
+	blockedDomain string
+	blockingMode  string
+	blockingIP    net.IP
+}
+
+type dnsProbeCollector struct {
+	config dnsProbeConfig
+
+	success         *prometheus.Desc
+	rcode           *prometheus.Desc
+	duration        *prometheus.HistogramVec
+	blockingSuccess *prometheus.Desc
+}
+
+func splitList(list string) []string {
+	var result []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func newDNSProbeCollector() (Collector, error) {
+	return newDNSProbe(dnsProbeConfig{
+		server:        dnsProbeServer,
+		names:         splitList(dnsProbeNames),
+		types:         splitList(strings.ToUpper(dnsProbeTypes)),
+		protocols:     splitList(strings.ToLower(dnsProbeProtocols)),
+		timeout:       dnsProbeTimeout,
+		blockedDomain: dnsProbeBlockedDomain,
+		blockingMode:  strings.ToUpper(dnsProbeBlockingMode),
+		blockingIP:    net.ParseIP(dnsProbeBlockingIP),
+	})
+}
+
+func newDNSProbe(config dnsProbeConfig) (*dnsProbeCollector, error) {
+	if len(config.protocols) == 0 {
+		return nil, errors.New("no protocol of dns_probe")
+	}
+	for _, queryType := range config.types {
+		if _, ok := dnsProbeQueryTypes[queryType]; !ok {
+			return nil, fmt.Errorf("unsupported query type of dns_probe: %s", queryType)
+		}
+	}
+	for _, protocol := range config.protocols {
+		if protocol != "udp" && protocol != "tcp" {
+			return nil, fmt.Errorf("unsupported protocol of dns_probe: %s", protocol)
+		}
+	}
+	switch config.blockingMode {
+	case blockingModeNull, blockingModeNXDomain, blockingModeNodata:
+	case blockingModeIPNodataAAAA, blockingModeIP:
+		// a domain which is not blocked is answered with an address too
+		if config.blockedDomain != "" && config.blockingIP.To4() == nil {
+			return nil, fmt.Errorf("blocking mode %s of dns_probe needs the IPv4 address of Pi-hole", config.blockingMode)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported blocking mode of dns_probe: %s", config.blockingMode)
+	}
+
+	return &dnsProbeCollector{
+		config: config,
+
+		success: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dns_probe", "success"),
+			"Whether the resolver answered the query with NOERROR.",
+			[]string{"name", "type", "protocol"}, nil,
+		),
+
+		rcode: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dns_probe", "rcode"),
+			"Response code of the answer to the query, -1 if there was no answer.",
+			[]string{"name", "type", "protocol"}, nil,
+		),
+
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "dns_probe",
+			Name:      "duration_seconds",
+			Help:      "Round-trip time of the queries which have been answered.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"type", "protocol"}),
+
+		blockingSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dns_probe", "blocking_success"),
+			"Whether the blocked domain has been answered according to the blocking mode.",
+			[]string{"domain", "mode"}, nil,
+		),
+	}, nil
+}
+
+// dnsProbeResult is the answer to a probe query
+type dnsProbeResult struct {
+	name      string
+	queryType string
+	protocol  string
+	rcode     float64
+}
+
+func (c *dnsProbeCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	var results []*dnsProbeResult
+	for _, protocol := range c.config.protocols {
+		for _, queryType := range c.config.types {
+			for _, name := range c.config.names {
+				results = append(results, &dnsProbeResult{name: name, queryType: queryType, protocol: protocol, rcode: -1})
+			}
+		}
+	}
+
+	// the queries run concurrently, so a dead resolver delays
+	// the scrape by a single timeout
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, dnsProbeConcurrency)
+	for _, result := range results {
+		wg.Add(1)
+		go func(result *dnsProbeResult) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			begin := time.Now()
+			header, _, err := c.query(result.protocol, result.name, dnsProbeQueryTypes[result.queryType])
+			if err == nil {
+				c.duration.WithLabelValues(result.queryType, result.protocol).Observe(time.Since(begin).Seconds())
+				result.rcode = float64(header.RCode)
+			}
+		}(result)
+	}
+
+	blocked := float64(0)
+	if c.config.blockedDomain != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if c.blocked() {
+				blocked = 1
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		success := float64(0)
+		if result.rcode == float64(dnsmessage.RCodeSuccess) {
+			success = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.success, prometheus.GaugeValue, success, result.name, result.queryType, result.protocol)
+		ch <- prometheus.MustNewConstMetric(c.rcode, prometheus.GaugeValue, result.rcode, result.name, result.queryType, result.protocol)
+	}
+	c.duration.Collect(ch)
+
+	if c.config.blockedDomain != "" {
+		ch <- prometheus.MustNewConstMetric(c.blockingSuccess, prometheus.GaugeValue, blocked, c.config.blockedDomain, c.config.blockingMode)
+	}
+
+	return nil
+}
+
+// blocked reports whether the A record of the blocked domain is answered
+// the way the blocking mode defines
+func (c *dnsProbeCollector) blocked() bool {
+	header, answers, err := c.query(c.config.protocols[0], c.config.blockedDomain, dnsmessage.TypeA)
+	if err != nil {
+		return false
+	}
+
+	switch c.config.blockingMode {
+	case blockingModeNXDomain:
+		return header.RCode == dnsmessage.RCodeNameError
+	case blockingModeNodata:
+		return header.RCode == dnsmessage.RCodeSuccess && len(answers) == 0
+	}
+
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return false
+	}
+
+	// NULL answers 0.0.0.0, the IP modes the address of Pi-hole
+	want := net.IPv4zero
+	if c.config.blockingMode != blockingModeNull {
+		want = c.config.blockingIP
+	}
+	addresses := 0
+	for _, answer := range answers {
+		a, ok := answer.Body.(*dnsmessage.AResource)
+		if !ok {
+			continue
+		}
+		if !net.IP(a.A[:]).Equal(want) {
+			return false
+		}
+		addresses++
+	}
+
+	return addresses > 0
+}
+
+var errDNSMismatch = errors.New("answer does not match the query")
+
+// query sends the query and returns the header and the answers of the response
+func (c *dnsProbeCollector) query(protocol string, name string, queryType dnsmessage.Type) (dnsmessage.Header, []dnsmessage.Resource, error) {
+	return exchangeDNS(c.config.server, protocol, c.config.timeout, name, queryType, dnsmessage.ClassINET)
+}
+
+// exchangeDNS sends the question to the server and returns
+// the header and the answers of the response
+func exchangeDNS(
+	server string,
+	protocol string,
+	timeout time.Duration,
+	name string,
+	queryType dnsmessage.Type,
+	class dnsmessage.Class,
+) (dnsmessage.Header, []dnsmessage.Resource, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	questionName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+
+	id := uint16(rand.Uint32())
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := builder.StartQuestions(); err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: questionName, Type: queryType, Class: class}); err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+	request, err := builder.Finish()
+	if err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+
+	conn, err := net.DialTimeout(protocol, server, timeout)
+	if err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+
+	var response []byte
+	if protocol == "tcp" {
+		response, err = exchangeTCP(conn, request)
+	} else {
+		response, err = exchangeUDP(conn, request)
+	}
+	if err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+
+	var parser dnsmessage.Parser
+	header, err := parser.Start(response)
+	if err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+	if header.ID != id || !header.Response {
+		return dnsmessage.Header{}, nil, errDNSMismatch
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+	answers, err := parser.AllAnswers()
+	if err != nil {
+		return dnsmessage.Header{}, nil, err
+	}
+
+	return header, answers, nil
+}
+
+func exchangeUDP(conn net.Conn, request []byte) ([]byte, error) {
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 4096)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response[:n], nil
+}
+
+// exchangeTCP sends and receives the messages prefixed by their length
+func exchangeTCP(conn net.Conn, request []byte) ([]byte, error) {
+	packet := make([]byte, 2+len(request))
+	binary.BigEndian.PutUint16(packet, uint16(len(request)))
+	copy(packet[2:], request)
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,328 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stubDNS answers `pi.hole` with 192.168.1.2, `blocked.example` with 0.0.0.0,
+// the CHAOS TXT queries of dnsmasq with stubChaos and every other name
+// with NXDOMAIN over UDP and TCP on the same port
+type stubDNS struct {
+	udp net.PacketConn
+	tcp net.Listener
+}
+
+func newStubDNS(t *testing.T) *stubDNS {
+	for i := 0; i < 10; i++ {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+		if err != nil {
+			udp.Close()
+
+			continue
+		}
+
+		s := &stubDNS{udp: udp, tcp: tcp}
+		go s.serveUDP()
+		go s.serveTCP()
+
+		return s
+	}
+	t.Fatal("no free port for UDP and TCP")
+
+	return nil
+}
+
+func (s *stubDNS) addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+func (s *stubDNS) close() {
+	s.udp.Close()
+	s.tcp.Close()
+}
+
+func (s *stubDNS) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if response := stubAnswer(buf[:n]); response != nil {
+			_, _ = s.udp.WriteTo(response, addr)
+		}
+	}
+}
+
+func (s *stubDNS) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err == nil {
+			request := make([]byte, length)
+			if _, err := io.ReadFull(conn, request); err == nil {
+				response := stubAnswer(request)
+				_ = binary.Write(conn, binary.BigEndian, uint16(len(response)))
+				_, _ = conn.Write(response)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func stubAnswer(request []byte) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(request)
+	if err != nil {
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil
+	}
+
+	if question.Class == dnsmessage.ClassCHAOS {
+		return stubChaosAnswer(header, question)
+	}
+
+	var address [4]byte
+	rcode := dnsmessage.RCodeSuccess
+	switch question.Name.String() {
+	case "pi.hole.":
+		address = [4]byte{192, 168, 1, 2}
+	case "blocked.example.":
+	default:
+		rcode = dnsmessage.RCodeNameError
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: rcode})
+	_ = builder.StartQuestions()
+	_ = builder.Question(question)
+	_ = builder.StartAnswers()
+	if rcode == dnsmessage.RCodeSuccess && question.Type == dnsmessage.TypeA {
+		_ = builder.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 2},
+			dnsmessage.AResource{A: address})
+	}
+	response, _ := builder.Finish()
+
+	return response
+}
+
+// stubChaos are the answers to the CHAOS TXT queries, one TXT record per item
+var stubChaos = map[string][]string{
+	"cachesize.bind.":  {"10000"},
+	"insertions.bind.": {"5321"},
+	"evictions.bind.":  {"12"},
+	"hits.bind.":       {"2754"},
+	"misses.bind.":     {"435"},
+	"servers.bind.":    {"8.8.8.8#53 400 3", "1.1.1.1#53 35 0"},
+}
+
+func stubChaosAnswer(header dnsmessage.Header, question dnsmessage.Question) []byte {
+	texts, ok := stubChaos[question.Name.String()]
+
+	rcode := dnsmessage.RCodeSuccess
+	if !ok || question.Type != dnsmessage.TypeTXT {
+		rcode = dnsmessage.RCodeRefused
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: rcode})
+	_ = builder.StartQuestions()
+	_ = builder.Question(question)
+	_ = builder.StartAnswers()
+	if rcode == dnsmessage.RCodeSuccess {
+		for _, text := range texts {
+			_ = builder.TXTResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassCHAOS},
+				dnsmessage.TXTResource{TXT: []string{text}})
+		}
+	}
+	response, _ := builder.Finish()
+
+	return response
+}
+
+func TestDNSProbeCollector(t *testing.T) {
+	server := newStubDNS(t)
+	defer server.close()
+
+	probe, err := newDNSProbe(dnsProbeConfig{
+		server:        server.addr(),
+		names:         []string{"pi.hole", "unknown.example"},
+		types:         []string{"A"},
+		protocols:     []string{"udp", "tcp"},
+		timeout:       time.Second,
+		blockedDomain: "blocked.example",
+		blockingMode:  blockingModeNull,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP ftl_dns_probe_blocking_success Whether the blocked domain has been answered according to the blocking mode.
+# TYPE ftl_dns_probe_blocking_success gauge
+ftl_dns_probe_blocking_success{domain="blocked.example",mode="NULL"} 1
+# HELP ftl_dns_probe_rcode Response code of the answer to the query, -1 if there was no answer.
+# TYPE ftl_dns_probe_rcode gauge
+ftl_dns_probe_rcode{name="pi.hole",protocol="tcp",type="A"} 0
+ftl_dns_probe_rcode{name="pi.hole",protocol="udp",type="A"} 0
+ftl_dns_probe_rcode{name="unknown.example",protocol="tcp",type="A"} 3
+ftl_dns_probe_rcode{name="unknown.example",protocol="udp",type="A"} 3
+# HELP ftl_dns_probe_success Whether the resolver answered the query with NOERROR.
+# TYPE ftl_dns_probe_success gauge
+ftl_dns_probe_success{name="pi.hole",protocol="tcp",type="A"} 1
+ftl_dns_probe_success{name="pi.hole",protocol="udp",type="A"} 1
+ftl_dns_probe_success{name="unknown.example",protocol="tcp",type="A"} 0
+ftl_dns_probe_success{name="unknown.example",protocol="udp",type="A"} 0
+`
+	collector := &testCollector{collector: probe}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want),
+		"ftl_dns_probe_blocking_success", "ftl_dns_probe_rcode", "ftl_dns_probe_success"); err != nil {
+		t.Error(err)
+	}
+	if collector.err != nil {
+		t.Error(collector.err)
+	}
+
+	// one histogram per protocol
+	metrics, err := gather(probe, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	histograms := 0
+	for _, metric := range metrics {
+		if strings.Contains(metric.Desc().String(), "ftl_dns_probe_duration_seconds") {
+			histograms++
+		}
+	}
+	if histograms != 2 {
+		t.Errorf("duration histograms = %d, want 2", histograms)
+	}
+
+	// NXDOMAIN mode does not accept the 0.0.0.0 answer
+	probe.config.blockingMode = blockingModeNXDomain
+	if probe.blocked() {
+		t.Error("blocked() should fail for NXDOMAIN mode")
+	}
+
+	// the IP modes accept only the address of Pi-hole, pi.hole stands for
+	// a blocked domain and a domain resolving to another address
+	probe.config.blockingMode = blockingModeIP
+	probe.config.blockedDomain = "pi.hole"
+	probe.config.blockingIP = net.ParseIP("192.168.1.2")
+	if !probe.blocked() {
+		t.Error("blocked() should succeed for the address of Pi-hole in IP mode")
+	}
+	probe.config.blockingIP = net.ParseIP("192.168.1.53")
+	if probe.blocked() {
+		t.Error("blocked() should fail for another address in IP mode")
+	}
+	probe.config.blockedDomain = "blocked.example"
+	probe.config.blockingIP = net.ParseIP("192.168.1.2")
+	if probe.blocked() {
+		t.Error("blocked() should fail for 0.0.0.0 in IP mode")
+	}
+
+	if _, err := newDNSProbe(dnsProbeConfig{protocols: []string{"udp"}, blockedDomain: "blocked.example", blockingMode: blockingModeIP}); err == nil {
+		t.Error("newDNSProbe() should fail for IP mode without the address of Pi-hole")
+	}
+}
+
+func TestDNSProbeCollector_timeout(t *testing.T) {
+	// the resolver never answers
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	var names []string
+	for i := 0; i < 10; i++ {
+		names = append(names, fmt.Sprintf("host%d.lan", i))
+	}
+	probe, err := newDNSProbe(dnsProbeConfig{
+		server:        silent.LocalAddr().String(),
+		names:         names,
+		types:         []string{"A", "AAAA"},
+		protocols:     []string{"udp"},
+		timeout:       100 * time.Millisecond,
+		blockedDomain: "blocked.example",
+		blockingMode:  blockingModeNull,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	if _, err := gather(probe, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("update() took %v for 21 queries, want them concurrently", elapsed)
+	}
+}
+
+func TestDNSProbeCollector_unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	probe, err := newDNSProbe(dnsProbeConfig{
+		server:       addr,
+		names:        []string{"pi.hole"},
+		types:        []string{"A"},
+		protocols:    []string{"tcp"},
+		timeout:      time.Second,
+		blockingMode: blockingModeNull,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP ftl_dns_probe_rcode Response code of the answer to the query, -1 if there was no answer.
+# TYPE ftl_dns_probe_rcode gauge
+ftl_dns_probe_rcode{name="pi.hole",protocol="tcp",type="A"} -1
+`
+	if err := testutil.CollectAndCompare(&testCollector{collector: probe}, strings.NewReader(want), "ftl_dns_probe_rcode"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := newDNSProbe(dnsProbeConfig{types: []string{"ANY"}, protocols: []string{"udp"}, blockingMode: blockingModeNull}); err == nil {
+		t.Error("newDNSProbe() should fail for unsupported type")
+	}
+}
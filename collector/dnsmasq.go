@@ -0,0 +1,197 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	dnsmasqServer  string
+	dnsmasqTimeout time.Duration
+)
+
+func init() {
+	registerCollector("dnsmasq", defaultDisabled, newDnsmasqCollector)
+
+	flag.StringVar(&dnsmasqServer, "collector.dnsmasq.server", "127.0.0.1:53", "Address of the resolver answering CHAOS TXT queries.")
+	flag.DurationVar(&dnsmasqTimeout, "collector.dnsmasq.timeout", 2*time.Second, "Timeout of a single CHAOS query.")
+}
+
+// dnsmasqCollector exposes the cache statistics which the dnsmasq core
+// of FTL answers to CHAOS TXT queries
+type dnsmasqCollector struct {
+	server  string
+	timeout time.Duration
+
+	cacheSize             *prometheus.Desc
+	cacheInsertions       *prometheus.Desc
+	cacheEvictions        *prometheus.Desc
+	cacheHits             *prometheus.Desc
+	cacheMisses           *prometheus.Desc
+	upstreamQueries       *prometheus.Desc
+	upstreamQueriesFailed *prometheus.Desc
+	upstreamInvalid       *prometheus.Desc
+}
+
+func newDnsmasqCollector() (Collector, error) {
+	return newDnsmasq(dnsmasqServer, dnsmasqTimeout), nil
+}
+
+func newDnsmasq(server string, timeout time.Duration) *dnsmasqCollector {
+	return &dnsmasqCollector{
+		server:  server,
+		timeout: timeout,
+
+		cacheSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "cache_size"),
+			"Configured size of the DNS cache.",
+			nil, nil,
+		),
+
+		cacheInsertions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "cache_insertions_total"),
+			"Entries inserted into the DNS cache.",
+			nil, nil,
+		),
+
+		cacheEvictions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "cache_evictions_total"),
+			"Entries evicted from the DNS cache before they expired.",
+			nil, nil,
+		),
+
+		cacheHits: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "cache_hits_total"),
+			"Queries answered from the DNS cache.",
+			nil, nil,
+		),
+
+		cacheMisses: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "cache_misses_total"),
+			"Queries which could not be answered from the DNS cache.",
+			nil, nil,
+		),
+
+		upstreamQueries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "upstream_queries_total"),
+			"Queries sent to the upstream server.",
+			[]string{"server"}, nil,
+		),
+
+		upstreamQueriesFailed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "upstream_queries_failed_total"),
+			"Queries to the upstream server which failed.",
+			[]string{"server"}, nil,
+		),
+
+		upstreamInvalid: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dnsmasq", "upstream_invalid_entries"),
+			"Entries of the upstream servers which could not be parsed.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *dnsmasqCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	values := []struct {
+		name      string
+		desc      *prometheus.Desc
+		valueType prometheus.ValueType
+	}{
+		{"cachesize.bind", c.cacheSize, prometheus.GaugeValue},
+		{"insertions.bind", c.cacheInsertions, prometheus.CounterValue},
+		{"evictions.bind", c.cacheEvictions, prometheus.CounterValue},
+		{"hits.bind", c.cacheHits, prometheus.CounterValue},
+		{"misses.bind", c.cacheMisses, prometheus.CounterValue},
+	}
+	for _, v := range values {
+		texts, err := c.query(v.name)
+		if err != nil {
+			return err
+		}
+		if len(texts) != 1 {
+			return fmt.Errorf("%s: unexpected answer %q", v.name, texts)
+		}
+
+		value, err := strconv.ParseFloat(texts[0], 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", v.name, err)
+		}
+		ch <- prometheus.MustNewConstMetric(v.desc, v.valueType, value)
+	}
+
+	servers, err := c.query("servers.bind")
+	if err != nil {
+		return err
+	}
+	invalid := 0
+	for _, server := range servers {
+		// every server is answered as `<address>#<port> <queries> <failed>`,
+		// other entries are skipped to keep the rest of the metrics
+		fields := strings.Fields(server)
+		if len(fields) != 3 {
+			invalid++
+
+			continue
+		}
+
+		queries, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			invalid++
+
+			continue
+		}
+		failed, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			invalid++
+
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.upstreamQueries, prometheus.CounterValue, queries, fields[0])
+		ch <- prometheus.MustNewConstMetric(c.upstreamQueriesFailed, prometheus.CounterValue, failed, fields[0])
+	}
+	ch <- prometheus.MustNewConstMetric(c.upstreamInvalid, prometheus.GaugeValue, float64(invalid))
+
+	return nil
+}
+
+// query returns the strings of all TXT answers to the CHAOS query
+func (c *dnsmasqCollector) query(name string) ([]string, error) {
+	header, answers, err := exchangeDNS(c.server, "udp", c.timeout, name, dnsmessage.TypeTXT, dnsmessage.ClassCHAOS)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("%s: %s", name, header.RCode)
+	}
+
+	var texts []string
+	for _, answer := range answers {
+		if txt, ok := answer.Body.(*dnsmessage.TXTResource); ok {
+			texts = append(texts, txt.TXT...)
+		}
+	}
+
+	return texts, nil
+}
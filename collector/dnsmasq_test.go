@@ -0,0 +1,95 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDnsmasqCollector(t *testing.T) {
+	server := newStubDNS(t)
+	defer server.close()
+
+	want := `
+# HELP ftl_dnsmasq_cache_evictions_total Entries evicted from the DNS cache before they expired.
+# TYPE ftl_dnsmasq_cache_evictions_total counter
+ftl_dnsmasq_cache_evictions_total 12
+# HELP ftl_dnsmasq_cache_hits_total Queries answered from the DNS cache.
+# TYPE ftl_dnsmasq_cache_hits_total counter
+ftl_dnsmasq_cache_hits_total 2754
+# HELP ftl_dnsmasq_cache_insertions_total Entries inserted into the DNS cache.
+# TYPE ftl_dnsmasq_cache_insertions_total counter
+ftl_dnsmasq_cache_insertions_total 5321
+# HELP ftl_dnsmasq_cache_misses_total Queries which could not be answered from the DNS cache.
+# TYPE ftl_dnsmasq_cache_misses_total counter
+ftl_dnsmasq_cache_misses_total 435
+# HELP ftl_dnsmasq_cache_size Configured size of the DNS cache.
+# TYPE ftl_dnsmasq_cache_size gauge
+ftl_dnsmasq_cache_size 10000
+# HELP ftl_dnsmasq_upstream_queries_failed_total Queries to the upstream server which failed.
+# TYPE ftl_dnsmasq_upstream_queries_failed_total counter
+ftl_dnsmasq_upstream_queries_failed_total{server="1.1.1.1#53"} 0
+ftl_dnsmasq_upstream_queries_failed_total{server="8.8.8.8#53"} 3
+# HELP ftl_dnsmasq_upstream_invalid_entries Entries of the upstream servers which could not be parsed.
+# TYPE ftl_dnsmasq_upstream_invalid_entries gauge
+ftl_dnsmasq_upstream_invalid_entries 0
+# HELP ftl_dnsmasq_upstream_queries_total Queries sent to the upstream server.
+# TYPE ftl_dnsmasq_upstream_queries_total counter
+ftl_dnsmasq_upstream_queries_total{server="1.1.1.1#53"} 35
+ftl_dnsmasq_upstream_queries_total{server="8.8.8.8#53"} 400
+`
+	c := &testCollector{collector: newDnsmasq(server.addr(), time.Second)}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+
+	// the resolver refuses the CHAOS queries it does not know
+	if _, err := c.collector.(*dnsmasqCollector).query("version.server"); err == nil {
+		t.Error("query() should fail for refused query")
+	}
+}
+
+func TestDnsmasqCollector_invalidServers(t *testing.T) {
+	servers := stubChaos["servers.bind."]
+	stubChaos["servers.bind."] = append([]string{"9.9.9.9#53 10", "149.112.112.112#53 many 0"}, servers...)
+	defer func() { stubChaos["servers.bind."] = servers }()
+
+	server := newStubDNS(t)
+	defer server.close()
+
+	want := `
+# HELP ftl_dnsmasq_upstream_invalid_entries Entries of the upstream servers which could not be parsed.
+# TYPE ftl_dnsmasq_upstream_invalid_entries gauge
+ftl_dnsmasq_upstream_invalid_entries 2
+# HELP ftl_dnsmasq_upstream_queries_total Queries sent to the upstream server.
+# TYPE ftl_dnsmasq_upstream_queries_total counter
+ftl_dnsmasq_upstream_queries_total{server="1.1.1.1#53"} 35
+ftl_dnsmasq_upstream_queries_total{server="8.8.8.8#53"} 400
+`
+	c := &testCollector{collector: newDnsmasq(server.addr(), time.Second)}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"ftl_dnsmasq_upstream_invalid_entries", "ftl_dnsmasq_upstream_queries_total"); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+}
@@ -25,6 +25,7 @@ type domainCollector struct {
 
 func init() {
 	registerCollector("domains", defaultEnabled, newDomainCollector)
+	registerMethods("domains", "GetTopDomains")
 }
 
 func newDomainCollector() (Collector, error) {
@@ -43,7 +44,7 @@ func newDomainCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *domainCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *domainCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	queries, err := client.GetTopDomains()
 	if err != nil {
 		return err
@@ -0,0 +1,254 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/ftltest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExporter_ftltest(t *testing.T) {
+	server, err := ftltest.NewUnixServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetFake(ftltest.Fake())
+
+	api, err := client.NewClient(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter, err := NewExporter(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	want := `
+# HELP ftl_scrape_collector_success ftl_exporter: Whether a collector succeeded.
+# TYPE ftl_scrape_collector_success gauge
+ftl_scrape_collector_success{collector="ad_domains"} 1
+ftl_scrape_collector_success{collector="clients"} 1
+ftl_scrape_collector_success{collector="domains"} 1
+ftl_scrape_collector_success{collector="forward_destinations"} 1
+ftl_scrape_collector_success{collector="queries_over_time"} 1
+ftl_scrape_collector_success{collector="query_types"} %s
+ftl_scrape_collector_success{collector="stats"} %s
+# HELP ftl_status Blocking status.
+# TYPE ftl_status gauge
+ftl_status 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(strings.NewReplacer("%s", "1").Replace(want)),
+		"ftl_scrape_collector_success", "ftl_status"); err != nil {
+		t.Error(err)
+	}
+
+	// a failing command must not break the other collectors sharing the session
+	server.SetFault(">stats", ftltest.Fault{Truncate: 10})
+	server.SetFault(">querytypes", ftltest.Fault{WrongFormat: true})
+	want = strings.Split(want, "# HELP ftl_status")[0]
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(strings.NewReplacer("%s", "0").Replace(want)),
+		"ftl_scrape_collector_success"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExporter_unsupported(t *testing.T) {
+	server, err := ftltest.NewUnixServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// FTL without `>querytypes` answers it as an unknown command
+	fake := ftltest.Fake()
+	fake.QueryTypes = nil
+	server.SetFake(fake)
+
+	api, err := client.NewClient(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter, err := NewExporter(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	want := `
+# HELP ftl_collector_supported ftl_exporter: Whether FTL supports the commands of a collector.
+# TYPE ftl_collector_supported gauge
+ftl_collector_supported{collector="ad_domains"} 1
+ftl_collector_supported{collector="clients"} 1
+ftl_collector_supported{collector="domains"} 1
+ftl_collector_supported{collector="forward_destinations"} 1
+ftl_collector_supported{collector="queries_over_time"} 1
+ftl_collector_supported{collector="query_types"} 0
+ftl_collector_supported{collector="stats"} 1
+# HELP ftl_scrape_collector_success ftl_exporter: Whether a collector succeeded.
+# TYPE ftl_scrape_collector_success gauge
+ftl_scrape_collector_success{collector="ad_domains"} 1
+ftl_scrape_collector_success{collector="clients"} 1
+ftl_scrape_collector_success{collector="domains"} 1
+ftl_scrape_collector_success{collector="forward_destinations"} 1
+ftl_scrape_collector_success{collector="queries_over_time"} 1
+ftl_scrape_collector_success{collector="query_types"} 1
+ftl_scrape_collector_success{collector="stats"} 1
+`
+	for i := 0; i < 2; i++ {
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+			"ftl_collector_supported", "ftl_scrape_collector_success"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// the unsupported command is sent only once within the retry interval
+	count := func() int {
+		count := 0
+		for _, command := range server.Commands() {
+			if command == ">querytypes" {
+				count++
+			}
+		}
+
+		return count
+	}
+	if got := count(); got != 1 {
+		t.Errorf(">querytypes sent %d times, want 1", got)
+	}
+
+	unsupported := `
+# HELP ftl_client_unsupported_commands_total ftl_exporter: FTL commands answered as unknown ones.
+# TYPE ftl_client_unsupported_commands_total counter
+ftl_client_unsupported_commands_total{command=">querytypes"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(unsupported),
+		"ftl_client_unsupported_commands_total"); err != nil {
+		t.Error(err)
+	}
+
+	// the command is probed again after the retry interval, e.g. after an FTL upgrade
+	server.SetFake(ftltest.Fake())
+	exporter.support.retry = 0
+	want = strings.Replace(want, `ftl_collector_supported{collector="query_types"} 0`, `ftl_collector_supported{collector="query_types"} 1`, 1)
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"ftl_collector_supported", "ftl_scrape_collector_success"); err != nil {
+		t.Error(err)
+	}
+	if got := count(); got != 2 {
+		t.Errorf(">querytypes sent %d times after retry interval, want 2", got)
+	}
+}
+
+func TestExporter_notFound(t *testing.T) {
+	// a proxy in front of the Pi-hole answers 404 while it restarts
+	var notFound int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/auth":
+			fmt.Fprint(w, `{"session":{"valid":true,"sid":null,"validity":-1,"message":"no password set"}}`)
+		case atomic.AddInt32(&notFound, -1) >= 0:
+			http.NotFound(w, r)
+		case r.URL.Path == "/api/stats/summary":
+			fmt.Fprint(w, `{"queries":{"total":3214},"clients":{"active":5,"total":7},"gravity":{"domains_being_blocked":94821}}`)
+		case r.URL.Path == "/api/dns/blocking":
+			fmt.Fprint(w, `{"blocking":"enabled","timer":null}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api, err := client.NewAPIClient(server.URL, "", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter, err := NewExporter(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := exporter.Filter("stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(stats)
+
+	want := `
+# HELP ftl_collector_supported ftl_exporter: Whether FTL supports the commands of a collector.
+# TYPE ftl_collector_supported gauge
+ftl_collector_supported{collector="stats"} 1
+# HELP ftl_scrape_collector_success ftl_exporter: Whether a collector succeeded.
+# TYPE ftl_scrape_collector_success gauge
+ftl_scrape_collector_success{collector="stats"} %s
+`
+	for _, success := range []string{"0", "1"} {
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(strings.Replace(want, "%s", success, 1)),
+			"ftl_collector_supported", "ftl_scrape_collector_success"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestExporter_recorder(t *testing.T) {
+	server, err := ftltest.NewUnixServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetFake(ftltest.Fake())
+
+	api, err := client.NewClient(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := client.NewRecorder(api)
+	exporter, err := NewExporter(recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exporter.observer == nil {
+		t.Error("NewExporter() should observe the socket client wrapped by the recorder")
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	call, ok := recorder.Last("GetStats")
+	if !ok || call.Err != nil || call.Result.(*client.Stats).Status != 1 {
+		t.Errorf("Last(GetStats) got = %+v, %v", call, ok)
+	}
+}
@@ -24,6 +24,7 @@ type forwardDestinationCollector struct {
 
 func init() {
 	registerCollector("forward_destinations", defaultEnabled, newForwardDestinationCollector)
+	registerMethods("forward_destinations", "GetForwardDestinations")
 }
 
 func newForwardDestinationCollector() (Collector, error) {
@@ -36,7 +37,7 @@ func newForwardDestinationCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *forwardDestinationCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *forwardDestinationCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	destinations, err := client.GetForwardDestinations()
 	if err != nil {
 		return err
@@ -0,0 +1,213 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ftlLogPath      string
+	ftlLogRulesFile string
+)
+
+// events whose last occurrence is exposed as a timestamp
+const (
+	ftlLogEventGravityReload = "gravity_reload"
+	ftlLogEventRestart       = "restart"
+)
+
+// ftlLogRule maps the lines matching the pattern to an event
+type ftlLogRule struct {
+	event   string
+	level   string
+	pattern *regexp.Regexp
+}
+
+// ftlLogRules are the built-in rules, the first matching rule counts a line
+var ftlLogRules = []ftlLogRule{
+	{ftlLogEventRestart, "info", regexp.MustCompile(`FTL started`)},
+	{ftlLogEventGravityReload, "info", regexp.MustCompile(`(?i)gravity database has been updated|reloading gravity`)},
+	{"dns_cache_reload", "info", regexp.MustCompile(`Reloading DNS cache`)},
+	{"shm_resize", "info", regexp.MustCompile(`Resizing "?/FTL-`)},
+	{"shm_exhausted", "error", regexp.MustCompile(`(?i)shared memory.*(failed|exhausted|not enough)|/dev/shm.*(full|no space)`)},
+	{"rate_limit", "warning", regexp.MustCompile(`Rate-limiting`)},
+	{"database_error", "error", regexp.MustCompile(`(?i)SQLite3 message|SQL .*failed|database (is locked|disk image is malformed)`)},
+	{"warning", "warning", regexp.MustCompile(`WARNING`)},
+	{"error", "error", regexp.MustCompile(`ERROR|FATAL|CRIT`)},
+}
+
+// ftlLogTimestamp matches the prefix `[2020-10-18 10:00:00.123 612M]`
+var ftlLogTimestamp = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3})`)
+
+func init() {
+	registerCollector("ftl_log", defaultDisabled, newFTLLogCollector)
+
+	flag.StringVar(&ftlLogPath, "collector.ftl_log.path", "/var/log/pihole-FTL.log", "Path of the log of FTL.")
+	flag.StringVar(
+		&ftlLogRulesFile,
+		"collector.ftl_log.rules-file",
+		"",
+		"File with additional rules checked before the built-in ones, one `<event> <level> <regexp>` per line.")
+}
+
+// ftlLogCollector counts the events logged to pihole-FTL.log since the
+// exporter started. The last gravity reload and restart are looked up
+// in the lines written before as well
+type ftlLogCollector struct {
+	sync.Mutex
+	tail  *logTail
+	rules []ftlLogRule
+	last  map[string]time.Time
+
+	events        *prometheus.CounterVec
+	gravityReload *prometheus.Desc
+	restart       *prometheus.Desc
+}
+
+func newFTLLogCollector() (Collector, error) {
+	rules := ftlLogRules
+	if ftlLogRulesFile != "" {
+		custom, err := readFTLLogRules(ftlLogRulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(custom, rules...)
+	}
+
+	return newFTLLog(ftlLogPath, rules), nil
+}
+
+// readFTLLogRules parses the rules file, empty lines and comments are skipped
+func readFTLLogRules(path string) ([]ftlLogRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ftlLogRule
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want `<event> <level> <regexp>`", path, number)
+		}
+
+		pattern, err := regexp.Compile(strings.TrimSpace(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+		rules = append(rules, ftlLogRule{event: fields[0], level: fields[1], pattern: pattern})
+	}
+
+	return rules, scanner.Err()
+}
+
+func newFTLLog(path string, rules []ftlLogRule) *ftlLogCollector {
+	c := &ftlLogCollector{
+		rules: rules,
+		last:  make(map[string]time.Time),
+
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "log",
+			Name:      "events_total",
+			Help:      "Events logged by FTL.",
+		}, []string{"event", "level"}),
+
+		gravityReload: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "log", "last_gravity_reload_timestamp_seconds"),
+			"Time of the last gravity reload logged by FTL.",
+			nil, nil,
+		),
+
+		restart: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "log", "last_restart_timestamp_seconds"),
+			"Time of the last start logged by FTL.",
+			nil, nil,
+		),
+	}
+	c.tail = newLogTail(path, func(line string) { c.match(line) })
+
+	// every rule is exposed from the start to get meaningful rates
+	for _, rule := range rules {
+		c.events.WithLabelValues(rule.event, rule.level)
+	}
+
+	return c
+}
+
+func (c *ftlLogCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	c.Lock()
+	defer c.Unlock()
+
+	lines, err := c.tail.lines()
+	for _, line := range lines {
+		if rule := c.match(line); rule != nil {
+			c.events.WithLabelValues(rule.event, rule.level).Inc()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	c.events.Collect(ch)
+	if last, ok := c.last[ftlLogEventGravityReload]; ok {
+		ch <- prometheus.MustNewConstMetric(c.gravityReload, prometheus.GaugeValue, float64(last.UnixNano())/1e9)
+	}
+	if last, ok := c.last[ftlLogEventRestart]; ok {
+		ch <- prometheus.MustNewConstMetric(c.restart, prometheus.GaugeValue, float64(last.UnixNano())/1e9)
+	}
+
+	return nil
+}
+
+// match returns the first rule matching the line and
+// remembers the time of the event
+func (c *ftlLogCollector) match(line string) *ftlLogRule {
+	for i := range c.rules {
+		rule := &c.rules[i]
+		if !rule.pattern.MatchString(line) {
+			continue
+		}
+
+		timestamp := time.Now()
+		if m := ftlLogTimestamp.FindStringSubmatch(line); m != nil {
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05.000", m[1], time.Local); err == nil {
+				timestamp = t
+			}
+		}
+		c.last[rule.event] = timestamp
+
+		return rule
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFTLLogCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rulesFile := filepath.Join(dir, "rules")
+	appendFile(t, rulesFile, "# custom rules\n\nupstream_timeout warning timed out .* upstream\n")
+	custom, err := readFTLLogRules(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "pihole-FTL.log")
+	appendFile(t, path, `[2020-10-18 09:00:00.000 612M] ########## FTL started! ##########
+[2020-10-18 09:00:01.000 612M] Resizing "/FTL-strings" from 40960 to 81920
+`)
+
+	// the lines written before the first scrape are history
+	c := &testCollector{collector: newFTLLog(path, append(custom, ftlLogRules[:7]...))}
+	if _, err := gather(c.collector, nil); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, `[2020-10-18 10:00:00.000 612M] Resizing "/FTL-queries" from 229376 to 458752
+[2020-10-18 10:00:01.000 612M] Rate-limiting client 192.168.1.3 for at least 60 seconds
+[2020-10-18 10:00:02.000 612M] SQLite3 message: database is locked (5)
+[2020-10-18 10:00:03.000 612/T613] Reloading DNS cache
+[2020-10-18 10:00:03.500 612/T613] Gravity database has been updated, reloading now
+[2020-10-18 10:00:04.000 612M] WARNING: query timed out waiting for upstream 8.8.8.8
+`)
+
+	timestamp := func(value string) string {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04:05.000", value, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fmt.Sprint(float64(parsed.UnixNano()) / 1e9)
+	}
+	want := `
+# HELP ftl_log_events_total Events logged by FTL.
+# TYPE ftl_log_events_total counter
+ftl_log_events_total{event="database_error",level="error"} 1
+ftl_log_events_total{event="dns_cache_reload",level="info"} 1
+ftl_log_events_total{event="gravity_reload",level="info"} 1
+ftl_log_events_total{event="rate_limit",level="warning"} 1
+ftl_log_events_total{event="restart",level="info"} 0
+ftl_log_events_total{event="shm_exhausted",level="error"} 0
+ftl_log_events_total{event="shm_resize",level="info"} 1
+ftl_log_events_total{event="upstream_timeout",level="warning"} 1
+# HELP ftl_log_last_gravity_reload_timestamp_seconds Time of the last gravity reload logged by FTL.
+# TYPE ftl_log_last_gravity_reload_timestamp_seconds gauge
+ftl_log_last_gravity_reload_timestamp_seconds ` + timestamp("2020-10-18 10:00:03.500") + `
+# HELP ftl_log_last_restart_timestamp_seconds Time of the last start logged by FTL.
+# TYPE ftl_log_last_restart_timestamp_seconds gauge
+ftl_log_last_restart_timestamp_seconds ` + timestamp("2020-10-18 09:00:00.000") + `
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+
+	appendFile(t, rulesFile, "broken\n")
+	if _, err := readFTLLogRules(rulesFile); err == nil {
+		t.Error("readFTLLogRules() should fail for incomplete rule")
+	}
+}
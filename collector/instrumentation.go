@@ -0,0 +1,100 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// clientObserver exposes connection events of the FTL client as metrics
+type clientObserver struct {
+	dials           prometheus.Counter
+	dialFailures    prometheus.Counter
+	commandDuration *prometheus.HistogramVec
+	unsupported     *prometheus.CounterVec
+}
+
+func newClientObserver() *clientObserver {
+	return &clientObserver{
+		dials: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "dials_total",
+			Help:      "ftl_exporter: Connections opened to the FTL socket.",
+		}),
+
+		dialFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "dial_failures_total",
+			Help:      "ftl_exporter: Failed attempts to connect to the FTL socket.",
+		}),
+
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "command_duration_seconds",
+			Help:      "ftl_exporter: Round-trip time of FTL commands.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"command", "success"}),
+
+		unsupported: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "unsupported_commands_total",
+			Help:      "ftl_exporter: FTL commands answered as unknown ones.",
+		}, []string{"command"}),
+	}
+}
+
+// Dialed implements client.Observer.
+func (o *clientObserver) Dialed(err error) {
+	o.dials.Inc()
+	if err != nil {
+		o.dialFailures.Inc()
+	}
+}
+
+// Done implements client.Observer.
+func (o *clientObserver) Done(command string, duration time.Duration, err error) {
+	success := "true"
+	if err != nil {
+		success = "false"
+	}
+	o.commandDuration.WithLabelValues(command, success).Observe(duration.Seconds())
+
+	if errors.Is(err, client.ErrUnsupported) {
+		o.unsupported.WithLabelValues(command).Inc()
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (o *clientObserver) Describe(ch chan<- *prometheus.Desc) {
+	o.dials.Describe(ch)
+	o.dialFailures.Describe(ch)
+	o.commandDuration.Describe(ch)
+	o.unsupported.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (o *clientObserver) Collect(ch chan<- prometheus.Metric) {
+	o.dials.Collect(ch)
+	o.dialFailures.Collect(ch)
+	o.commandDuration.Collect(ch)
+	o.unsupported.Collect(ch)
+}
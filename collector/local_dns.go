@@ -0,0 +1,383 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	localDNSCustomList    string
+	localDNSCNAMEConf     string
+	localDNSVerifyServer  string
+	localDNSVerifyTimeout time.Duration
+)
+
+// issues of the local records, the values are the label values
+const (
+	localDNSDuplicate     = "duplicate"
+	localDNSConflict      = "conflict"
+	localDNSDanglingCNAME = "dangling_cname"
+	localDNSInvalid       = "invalid"
+)
+
+func init() {
+	registerCollector("local_dns", defaultDisabled, newLocalDNSCollector)
+
+	flag.StringVar(&localDNSCustomList, "collector.local_dns.custom-list", "/etc/pihole/custom.list", "Path of the local DNS records.")
+	flag.StringVar(
+		&localDNSCNAMEConf,
+		"collector.local_dns.cname-conf",
+		"/etc/dnsmasq.d/05-pihole-custom-cname.conf",
+		"Path of the local CNAME records.")
+	flag.StringVar(
+		&localDNSVerifyServer,
+		"collector.local_dns.verify-server",
+		"",
+		"Address of the Pi-hole resolver to verify the records with (empty disables the verification).")
+	flag.DurationVar(
+		&localDNSVerifyTimeout,
+		"collector.local_dns.verify-timeout",
+		2*time.Second,
+		"Timeout of the verification of all the records, the records without an answer by then are reported as not resolving.")
+}
+
+// localDNSVerifyConcurrency limits the verification queries in flight
+const localDNSVerifyConcurrency = 16
+
+// localDNSRecord is a local A, AAAA or CNAME record
+type localDNSRecord struct {
+	name       string
+	recordType string
+	value      string
+}
+
+// localDNSConfig defines the files and the resolver of the collector
+type localDNSConfig struct {
+	customList    string
+	cnameConf     string
+	verifyServer  string
+	verifyTimeout time.Duration
+}
+
+type localDNSCollector struct {
+	config localDNSConfig
+
+	records  *prometheus.Desc
+	issues   *prometheus.Desc
+	issue    *prometheus.Desc
+	resolves *prometheus.Desc
+}
+
+func newLocalDNSCollector() (Collector, error) {
+	return newLocalDNS(localDNSConfig{
+		customList:    localDNSCustomList,
+		cnameConf:     localDNSCNAMEConf,
+		verifyServer:  localDNSVerifyServer,
+		verifyTimeout: localDNSVerifyTimeout,
+	}), nil
+}
+
+func newLocalDNS(config localDNSConfig) *localDNSCollector {
+	return &localDNSCollector{
+		config: config,
+
+		records: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "local_dns", "records"),
+			"Local DNS records by type.",
+			[]string{"type"}, nil,
+		),
+
+		issues: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "local_dns", "issues"),
+			"Local DNS names with the issue.",
+			[]string{"issue"}, nil,
+		),
+
+		issue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "local_dns", "issue_info"),
+			"Local DNS name with the issue, the file and line for invalid records.",
+			[]string{"name", "issue"}, nil,
+		),
+
+		resolves: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "local_dns", "record_resolves"),
+			"Whether Pi-hole answers the name with the value of the local record.",
+			[]string{"name", "type", "value"}, nil,
+		),
+	}
+}
+
+func (c *localDNSCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	// Pi-hole creates the files with the first record
+	hosts, invalidHosts, err := readCustomList(c.config.customList)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	cnames, invalidCNAMEs, err := readCNAMEConf(c.config.cnameConf)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	records := append(hosts, cnames...)
+
+	issues := map[string]map[string]bool{
+		localDNSDuplicate:     {},
+		localDNSConflict:      {},
+		localDNSDanglingCNAME: {},
+		localDNSInvalid:       {},
+	}
+	for _, position := range append(invalidHosts, invalidCNAMEs...) {
+		issues[localDNSInvalid][position] = true
+	}
+
+	counts := map[string]float64{"A": 0, "AAAA": 0, "CNAME": 0}
+	seen := make(map[localDNSRecord]bool)
+	values := make(map[string]map[string]bool)
+	for _, record := range records {
+		counts[record.recordType]++
+		if seen[record] {
+			issues[localDNSDuplicate][record.name] = true
+
+			continue
+		}
+		seen[record] = true
+
+		key := record.name + "/" + record.recordType
+		if values[key] == nil {
+			values[key] = make(map[string]bool)
+		}
+		values[key][record.value] = true
+	}
+	for _, record := range records {
+		// an alias can't have addresses of any type, see --cname of dnsmasq
+		ipv4, ipv6, targets := values[record.name+"/A"], values[record.name+"/AAAA"], values[record.name+"/CNAME"]
+		conflict := len(ipv4) > 1 || len(ipv6) > 1 || len(targets) > 1
+		if conflict || len(targets) > 0 && len(ipv4)+len(ipv6) > 0 {
+			issues[localDNSConflict][record.name] = true
+		}
+
+		if record.recordType == "CNAME" && !resolvesLocally(record.value, values) {
+			issues[localDNSDanglingCNAME][record.name] = true
+		}
+	}
+
+	for recordType, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.records, prometheus.GaugeValue, count, recordType)
+	}
+	for issue, names := range issues {
+		ch <- prometheus.MustNewConstMetric(c.issues, prometheus.GaugeValue, float64(len(names)), issue)
+		for name := range names {
+			ch <- prometheus.MustNewConstMetric(c.issue, prometheus.GaugeValue, 1, name, issue)
+		}
+	}
+
+	if c.config.verifyServer != "" {
+		verified := make([]localDNSRecord, 0, len(seen))
+		for record := range seen {
+			verified = append(verified, record)
+		}
+		sort.Slice(verified, func(i, j int) bool { return verified[i].name < verified[j].name })
+
+		for i, resolves := range c.verifyAll(verified) {
+			record := verified[i]
+			ch <- prometheus.MustNewConstMetric(c.resolves, prometheus.GaugeValue, resolves, record.name, record.recordType, record.value)
+		}
+	}
+
+	return nil
+}
+
+// resolvesLocally follows the chain of the aliases from the name and reports
+// whether it ends with a local address, dnsmasq answers only such aliases
+func resolvesLocally(name string, values map[string]map[string]bool) bool {
+	visited := make(map[string]bool)
+	for !visited[name] {
+		visited[name] = true
+		if values[name+"/A"] != nil || values[name+"/AAAA"] != nil {
+			return true
+		}
+
+		// an alias with several targets is a conflict already
+		targets := values[name+"/CNAME"]
+		if len(targets) != 1 {
+			return false
+		}
+		for target := range targets {
+			name = target
+		}
+	}
+
+	return false
+}
+
+// verifyAll verifies the records concurrently within the verification timeout
+// and returns 1 for the records resolving to their value and 0 otherwise
+func (c *localDNSCollector) verifyAll(records []localDNSRecord) []float64 {
+	deadline := time.Now().Add(c.config.verifyTimeout)
+	results := make([]float64, len(records))
+	slots := make(chan struct{}, localDNSVerifyConcurrency)
+
+	var wg sync.WaitGroup
+	for i := range records {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if c.verify(records[i], deadline) {
+				results[i] = 1
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// verify reports whether the answer of the resolver contains the value of the record
+// before the deadline
+func (c *localDNSCollector) verify(record localDNSRecord, deadline time.Time) bool {
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return false
+	}
+
+	queryType := dnsmessage.TypeA
+	if record.recordType == "AAAA" {
+		queryType = dnsmessage.TypeAAAA
+	}
+
+	header, answers, err := exchangeDNS(c.config.verifyServer, "udp", timeout, record.name, queryType, dnsmessage.ClassINET)
+	if err != nil || header.RCode != dnsmessage.RCodeSuccess {
+		return false
+	}
+
+	for _, answer := range answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			if net.IP(body.A[:]).Equal(net.ParseIP(record.value)) {
+				return true
+			}
+		case *dnsmessage.AAAAResource:
+			if net.IP(body.AAAA[:]).Equal(net.ParseIP(record.value)) {
+				return true
+			}
+		case *dnsmessage.CNAMEResource:
+			if record.recordType == "CNAME" && strings.EqualFold(strings.TrimSuffix(body.CNAME.String(), "."), record.value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readCustomList parses the `<address> <name>...` lines of custom.list
+// and returns the records and the positions of the invalid lines
+func readCustomList(path string) ([]localDNSRecord, []string, error) {
+	var records []localDNSRecord
+	var invalid []string
+
+	err := readLines(path, func(n int, line string) {
+		fields := strings.Fields(line)
+		ip := net.ParseIP(fields[0])
+		if len(fields) < 2 || ip == nil {
+			invalid = append(invalid, linePosition(path, n))
+
+			return
+		}
+
+		recordType := "AAAA"
+		if ip.To4() != nil {
+			recordType = "A"
+		}
+		for _, name := range fields[1:] {
+			records = append(records, localDNSRecord{name: strings.ToLower(name), recordType: recordType, value: ip.String()})
+		}
+	})
+
+	return records, invalid, err
+}
+
+// readCNAMEConf parses the `cname=<alias>,...,<target>[,<ttl>]` lines
+// of the dnsmasq configuration and returns the records and the positions
+// of the invalid lines
+func readCNAMEConf(path string) ([]localDNSRecord, []string, error) {
+	var records []localDNSRecord
+	var invalid []string
+
+	err := readLines(path, func(n int, line string) {
+		if !strings.HasPrefix(line, "cname=") {
+			return
+		}
+
+		names := strings.Split(strings.TrimPrefix(line, "cname="), ",")
+		if _, err := strconv.Atoi(names[len(names)-1]); err == nil {
+			names = names[:len(names)-1]
+		}
+		if len(names) < 2 {
+			invalid = append(invalid, linePosition(path, n))
+
+			return
+		}
+
+		target := strings.ToLower(strings.TrimSpace(names[len(names)-1]))
+		for _, alias := range names[:len(names)-1] {
+			records = append(records, localDNSRecord{name: strings.ToLower(strings.TrimSpace(alias)), recordType: "CNAME", value: target})
+		}
+	})
+
+	return records, invalid, err
+}
+
+// linePosition returns `<file>:<line>`, the label of an invalid line
+// which doesn't expose its content
+func linePosition(path string, n int) string {
+	return filepath.Base(path) + ":" + strconv.Itoa(n)
+}
+
+// readLines calls the function with the number and the text of the lines
+// of the file which are neither empty nor comments
+func readLines(path string, line func(int, string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text != "" && !strings.HasPrefix(text, "#") {
+			line(n, text)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLocalDNSCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_local_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"custom.list": `192.168.1.2 pi.hole
+192.168.1.10 nas.lan NAS.lan
+192.168.1.10 nas.lan
+192.168.1.11 printer.lan
+192.168.1.12 printer.lan
+fd00::2 pi.hole
+fd00::25 mail.lan
+not-an-address broken.lan
+`,
+		"05-pihole-custom-cname.conf": `cname=files.lan,nas.lan
+cname=www.lan,intranet.lan,web.lan,300
+cname=blocked.example,pi.hole
+cname=incomplete.lan
+cname=docs.lan,files.lan
+cname=old.lan,www.lan
+cname=mail.lan,nas.lan
+cname=loop1.lan,loop2.lan
+cname=loop2.lan,loop1.lan
+`,
+	})
+
+	server := newStubDNS(t)
+	defer server.close()
+
+	c := &testCollector{collector: newLocalDNS(localDNSConfig{
+		customList:    filepath.Join(dir, "custom.list"),
+		cnameConf:     filepath.Join(dir, "05-pihole-custom-cname.conf"),
+		verifyServer:  server.addr(),
+		verifyTimeout: time.Second,
+	})}
+
+	// the stub answers only pi.hole with 192.168.1.2, the invalid
+	// records are reported by their file and line
+	want := `
+# HELP ftl_local_dns_issue_info Local DNS name with the issue, the file and line for invalid records.
+# TYPE ftl_local_dns_issue_info gauge
+ftl_local_dns_issue_info{issue="conflict",name="mail.lan"} 1
+ftl_local_dns_issue_info{issue="conflict",name="printer.lan"} 1
+ftl_local_dns_issue_info{issue="dangling_cname",name="intranet.lan"} 1
+ftl_local_dns_issue_info{issue="dangling_cname",name="loop1.lan"} 1
+ftl_local_dns_issue_info{issue="dangling_cname",name="loop2.lan"} 1
+ftl_local_dns_issue_info{issue="dangling_cname",name="old.lan"} 1
+ftl_local_dns_issue_info{issue="dangling_cname",name="www.lan"} 1
+ftl_local_dns_issue_info{issue="duplicate",name="nas.lan"} 1
+ftl_local_dns_issue_info{issue="invalid",name="05-pihole-custom-cname.conf:4"} 1
+ftl_local_dns_issue_info{issue="invalid",name="custom.list:8"} 1
+# HELP ftl_local_dns_issues Local DNS names with the issue.
+# TYPE ftl_local_dns_issues gauge
+ftl_local_dns_issues{issue="conflict"} 2
+ftl_local_dns_issues{issue="dangling_cname"} 5
+ftl_local_dns_issues{issue="duplicate"} 1
+ftl_local_dns_issues{issue="invalid"} 2
+# HELP ftl_local_dns_record_resolves Whether Pi-hole answers the name with the value of the local record.
+# TYPE ftl_local_dns_record_resolves gauge
+ftl_local_dns_record_resolves{name="blocked.example",type="CNAME",value="pi.hole"} 0
+ftl_local_dns_record_resolves{name="docs.lan",type="CNAME",value="files.lan"} 0
+ftl_local_dns_record_resolves{name="files.lan",type="CNAME",value="nas.lan"} 0
+ftl_local_dns_record_resolves{name="intranet.lan",type="CNAME",value="web.lan"} 0
+ftl_local_dns_record_resolves{name="loop1.lan",type="CNAME",value="loop2.lan"} 0
+ftl_local_dns_record_resolves{name="loop2.lan",type="CNAME",value="loop1.lan"} 0
+ftl_local_dns_record_resolves{name="mail.lan",type="AAAA",value="fd00::25"} 0
+ftl_local_dns_record_resolves{name="mail.lan",type="CNAME",value="nas.lan"} 0
+ftl_local_dns_record_resolves{name="nas.lan",type="A",value="192.168.1.10"} 0
+ftl_local_dns_record_resolves{name="old.lan",type="CNAME",value="www.lan"} 0
+ftl_local_dns_record_resolves{name="pi.hole",type="A",value="192.168.1.2"} 1
+ftl_local_dns_record_resolves{name="pi.hole",type="AAAA",value="fd00::2"} 0
+ftl_local_dns_record_resolves{name="printer.lan",type="A",value="192.168.1.11"} 0
+ftl_local_dns_record_resolves{name="printer.lan",type="A",value="192.168.1.12"} 0
+ftl_local_dns_record_resolves{name="www.lan",type="CNAME",value="web.lan"} 0
+# HELP ftl_local_dns_records Local DNS records by type.
+# TYPE ftl_local_dns_records gauge
+ftl_local_dns_records{type="A"} 6
+ftl_local_dns_records{type="AAAA"} 2
+ftl_local_dns_records{type="CNAME"} 9
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+}
+
+func TestLocalDNSCollector_verifyTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_local_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var hosts strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&hosts, "192.168.1.%d host%d.lan\n", i, i)
+	}
+	writeFiles(t, dir, map[string]string{"custom.list": hosts.String()})
+
+	// the resolver never answers
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	collector := newLocalDNS(localDNSConfig{
+		customList:    filepath.Join(dir, "custom.list"),
+		verifyServer:  silent.LocalAddr().String(),
+		verifyTimeout: 100 * time.Millisecond,
+	})
+
+	begin := time.Now()
+	metrics, err := gather(collector, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("update() took %v, want the verification within its timeout", elapsed)
+	}
+	if len(metrics) < 50 {
+		t.Errorf("update() got %d metrics, want the records reported as not resolving", len(metrics))
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	pollInterval time.Duration
+	pollDeltas   bool
+)
+
+func init() {
+	flag.DurationVar(
+		&pollInterval,
+		"collector.poll-interval",
+		0,
+		"Poll collectors in background with this interval and serve scrapes from memory (0 runs collectors on scrape).")
+	flag.BoolVar(
+		&pollDeltas,
+		"collector.poll-deltas",
+		false,
+		"Export the change of every value of the polled collectors since their previous poll as <metric>_poll_delta.")
+}
+
+// Polled reports whether any collector runs in background
+func (collector Exporter) Polled() bool {
+	for _, cache := range collector.caches {
+		if cache.polled() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartPolling runs every collector with a poll interval in background
+// until stop is closed. A nil channel keeps polling forever
+func (collector Exporter) StartPolling(stop <-chan struct{}) {
+	for name, c := range collector.collectors {
+		cache := collector.caches[name]
+		if !cache.polled() {
+			continue
+		}
+
+		log.Println("Collector", name, "is polled every", cache.interval)
+
+		go poll(name, c, cache, collector.support, collector.client, stop)
+	}
+}
+
+func poll(name string, c Collector, cache *collectorCache, support *commandSupport, client client.FTLAPI, stop <-chan struct{}) {
+	ticker := time.NewTicker(cache.interval)
+	defer ticker.Stop()
+
+	for {
+		if support.supported(name) {
+			session, closeSession := newSession(client)
+			cache.refresh(c, session, time.Now())
+			closeSession()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollValue is a gauge, counter or untyped value of a polled metric
+type pollValue struct {
+	name        string
+	labelNames  []string
+	labelValues []string
+	value       float64
+	counter     bool
+}
+
+// deltaMetrics returns the change of the values since the previous poll
+// together with the values to compare the next poll with. Counters which
+// have been reset count from zero, series without a previous value are skipped
+func deltaMetrics(previous map[string]pollValue, metrics []prometheus.Metric) ([]prometheus.Metric, map[string]pollValue) {
+	values, err := pollValues(metrics)
+	if err != nil {
+		log.Println("Failed to compute poll deltas:", err)
+
+		return nil, nil
+	}
+
+	var deltas []prometheus.Metric
+	for key, v := range values {
+		before, ok := previous[key]
+		if !ok {
+			continue
+		}
+
+		delta := v.value - before.value
+		if v.counter && delta < 0 {
+			delta = v.value
+		}
+		desc := prometheus.NewDesc(v.name+"_poll_delta", "Change of "+v.name+" since the previous poll.", v.labelNames, nil)
+		deltas = append(deltas, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, delta, v.labelValues...))
+	}
+
+	return deltas, values
+}
+
+// pollValues returns the values of the metrics by their names and labels,
+// histograms and summaries have no single value and are skipped
+func pollValues(metrics []prometheus.Metric) (map[string]pollValue, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metricList(metrics)); err != nil {
+		return nil, err
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]pollValue)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			v := pollValue{name: family.GetName()}
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				v.value = metric.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				v.value = metric.GetCounter().GetValue()
+				v.counter = true
+			case dto.MetricType_UNTYPED:
+				v.value = metric.GetUntyped().GetValue()
+			default:
+				continue
+			}
+
+			// the registry sorts the labels by name
+			key := []string{v.name}
+			for _, label := range metric.Label {
+				v.labelNames = append(v.labelNames, label.GetName())
+				v.labelValues = append(v.labelValues, label.GetValue())
+				key = append(key, label.GetName()+"="+label.GetValue())
+			}
+			values[strings.Join(key, "\xff")] = v
+		}
+	}
+
+	return values, nil
+}
+
+// metricList is an unchecked collector of the given metrics
+type metricList []prometheus.Metric
+
+func (l metricList) Describe(chan<- *prometheus.Desc) {}
+
+func (l metricList) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range l {
+		ch <- metric
+	}
+}
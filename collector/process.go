@@ -0,0 +1,248 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	processPidFile string
+	processProcfs  string
+	processShmDir  string
+)
+
+// userHZ is the unit of the times in /proc/<pid>/stat
+const userHZ = 100
+
+func init() {
+	registerCollector("process", defaultDisabled, newProcessCollector)
+
+	flag.StringVar(&processPidFile, "collector.process.pid-file", "/run/pihole-FTL.pid", "File with the PID of FTL.")
+	flag.StringVar(&processProcfs, "collector.process.procfs", "/proc", "Mount point of procfs.")
+	flag.StringVar(&processShmDir, "collector.process.shm-dir", "/dev/shm", "Directory of the shared memory segments of FTL.")
+}
+
+// processConfig defines where the collector looks for the FTL process
+type processConfig struct {
+	pidFile string
+	procfs  string
+	shmDir  string
+}
+
+type processCollector struct {
+	config processConfig
+
+	// fdsWarning logs once that the file descriptors can't be counted,
+	// FTL runs as another user, so it is common for a non-root exporter
+	fdsWarning sync.Once
+
+	cpu       *prometheus.Desc
+	rss       *prometheus.Desc
+	vsize     *prometheus.Desc
+	fds       *prometheus.Desc
+	threads   *prometheus.Desc
+	startTime *prometheus.Desc
+	shm       *prometheus.Desc
+}
+
+func newProcessCollector() (Collector, error) {
+	return newProcess(processConfig{
+		pidFile: processPidFile,
+		procfs:  processProcfs,
+		shmDir:  processShmDir,
+	}), nil
+}
+
+func newProcess(config processConfig) *processCollector {
+	return &processCollector{
+		config: config,
+
+		cpu: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "process", "cpu_seconds_total"),
+			"User and system CPU time spent by FTL.",
+			nil, nil,
+		),
+
+		rss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "process", "resident_memory_bytes"),
+			"Resident memory size of FTL.",
+			nil, nil,
+		),
+
+		vsize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "process", "virtual_memory_bytes"),
+			"Virtual memory size of FTL.",
+			nil, nil,
+		),
+
+		fds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "process", "open_fds"),
+			"Open file descriptors of FTL.",
+			nil, nil,
+		),
+
+		threads: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "process", "threads"),
+			"Threads of FTL.",
+			nil, nil,
+		),
+
+		startTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "process", "start_time_seconds"),
+			"Start time of FTL since unix epoch.",
+			nil, nil,
+		),
+
+		shm: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "shm", "segment_bytes"),
+			"Size of the shared memory segment of FTL.",
+			[]string{"segment"}, nil,
+		),
+	}
+}
+
+func (c *processCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	content, err := ioutil.ReadFile(c.config.pidFile)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.config.pidFile, err)
+	}
+	dir := filepath.Join(c.config.procfs, strconv.Itoa(pid))
+
+	stat, err := readProcStat(filepath.Join(dir, "stat"))
+	if err != nil {
+		return err
+	}
+	bootTime, err := readBootTime(filepath.Join(c.config.procfs, "stat"))
+	if err != nil {
+		return err
+	}
+	fds, fdsErr := ioutil.ReadDir(filepath.Join(dir, "fd"))
+	if fdsErr != nil {
+		c.fdsWarning.Do(func() {
+			log.Println("Open file descriptors of FTL are not exported:", fdsErr)
+		})
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, float64(stat.utime+stat.stime)/userHZ)
+	ch <- prometheus.MustNewConstMetric(c.rss, prometheus.GaugeValue, float64(stat.rss*int64(os.Getpagesize())))
+	ch <- prometheus.MustNewConstMetric(c.vsize, prometheus.GaugeValue, float64(stat.vsize))
+	if fdsErr == nil {
+		ch <- prometheus.MustNewConstMetric(c.fds, prometheus.GaugeValue, float64(len(fds)))
+	}
+	ch <- prometheus.MustNewConstMetric(c.threads, prometheus.GaugeValue, float64(stat.threads))
+	ch <- prometheus.MustNewConstMetric(c.startTime, prometheus.GaugeValue, float64(bootTime)+float64(stat.startTime)/userHZ)
+
+	segments, err := filepath.Glob(filepath.Join(c.config.shmDir, "FTL-*"))
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.shm, prometheus.GaugeValue, float64(info.Size()), filepath.Base(segment))
+	}
+
+	return nil
+}
+
+// procStat holds the fields of /proc/<pid>/stat used by the collector
+type procStat struct {
+	utime     uint64
+	stime     uint64
+	threads   int64
+	startTime uint64
+	vsize     uint64
+	rss       int64
+}
+
+// readProcStat parses /proc/<pid>/stat, see proc(5)
+func readProcStat(path string) (*procStat, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the command may contain spaces and parentheses, the fields
+	// start with the state after the last parenthesis
+	i := strings.LastIndex(string(content), ")")
+	if i < 0 {
+		return nil, fmt.Errorf("%s: no command", path)
+	}
+	fields := strings.Fields(string(content[i+1:]))
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("%s: %d fields", path, len(fields))
+	}
+
+	// fields[0] is the 3rd field of proc(5)
+	stat := &procStat{}
+	values := []struct {
+		field int
+		value interface{}
+	}{
+		{14, &stat.utime},
+		{15, &stat.stime},
+		{20, &stat.threads},
+		{22, &stat.startTime},
+		{23, &stat.vsize},
+		{24, &stat.rss},
+	}
+	for _, v := range values {
+		if _, err := fmt.Sscan(fields[v.field-3], v.value); err != nil {
+			return nil, fmt.Errorf("%s: field %d: %w", path, v.field, err)
+		}
+	}
+
+	return stat, nil
+}
+
+// readBootTime returns the boot time from /proc/stat in seconds since unix epoch
+func readBootTime(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("%s: no btime", path)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_process")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// utime 1500, stime 500, 12 threads, started 3000 ticks after boot,
+	// 200 MiB virtual and 1000 pages resident memory
+	writeFiles(t, dir, map[string]string{
+		"run/pihole-FTL.pid": "612\n",
+		"proc/stat":          "cpu  1 2 3 4\nbtime 1603000000\nprocesses 1000\n",
+		"proc/612/stat": "612 (pihole-FTL) S 1 612 612 0 -1 4194624 1000 0 0 0 1500 500 0 0 20 0 12 0 3000 " +
+			"209715200 1000 18446744073709551615 1 1 0 0 0 0 0 4096 0 0 0 0 17 1 0 0 0 0 0\n",
+		"proc/612/fd/0":         "",
+		"proc/612/fd/1":         "",
+		"proc/612/fd/2":         "",
+		"shm/FTL-strings":       strings.Repeat("x", 4096),
+		"shm/FTL-queries":       strings.Repeat("x", 8192),
+		"shm/other-application": "x",
+	})
+
+	c := &testCollector{collector: newProcess(processConfig{
+		pidFile: filepath.Join(dir, "run/pihole-FTL.pid"),
+		procfs:  filepath.Join(dir, "proc"),
+		shmDir:  filepath.Join(dir, "shm"),
+	})}
+
+	want := fmt.Sprintf(`
+# HELP ftl_process_cpu_seconds_total User and system CPU time spent by FTL.
+# TYPE ftl_process_cpu_seconds_total counter
+ftl_process_cpu_seconds_total 20
+# HELP ftl_process_open_fds Open file descriptors of FTL.
+# TYPE ftl_process_open_fds gauge
+ftl_process_open_fds 3
+# HELP ftl_process_resident_memory_bytes Resident memory size of FTL.
+# TYPE ftl_process_resident_memory_bytes gauge
+ftl_process_resident_memory_bytes %d
+# HELP ftl_process_start_time_seconds Start time of FTL since unix epoch.
+# TYPE ftl_process_start_time_seconds gauge
+ftl_process_start_time_seconds 1.60300003e+09
+# HELP ftl_process_threads Threads of FTL.
+# TYPE ftl_process_threads gauge
+ftl_process_threads 12
+# HELP ftl_process_virtual_memory_bytes Virtual memory size of FTL.
+# TYPE ftl_process_virtual_memory_bytes gauge
+ftl_process_virtual_memory_bytes 2.097152e+08
+# HELP ftl_shm_segment_bytes Size of the shared memory segment of FTL.
+# TYPE ftl_shm_segment_bytes gauge
+ftl_shm_segment_bytes{segment="FTL-queries"} 8192
+ftl_shm_segment_bytes{segment="FTL-strings"} 4096
+`, 1000*os.Getpagesize())
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+
+	// the file descriptors of FTL running as another user are not readable
+	if err := os.RemoveAll(filepath.Join(dir, "proc/612/fd")); err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Replace(want, `# HELP ftl_process_open_fds Open file descriptors of FTL.
+# TYPE ftl_process_open_fds gauge
+ftl_process_open_fds 3
+`, "", 1)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+
+	// FTL is not running
+	writeFiles(t, dir, map[string]string{"run/pihole-FTL.pid": "613\n"})
+	if _, err := gather(c.collector, nil); err == nil {
+		t.Error("update() should fail for missing process")
+	}
+}
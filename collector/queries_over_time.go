@@ -26,6 +26,7 @@ type queriesOverTimeCollector struct {
 
 func init() {
 	registerCollector("queries_over_time", defaultEnabled, newQueriesOverTimeCollector)
+	registerMethods("queries_over_time", "GetQueriesOverTime")
 }
 
 func newQueriesOverTimeCollector() (Collector, error) {
@@ -44,7 +45,7 @@ func newQueriesOverTimeCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *queriesOverTimeCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *queriesOverTimeCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	queriesOverTime, err := client.GetQueriesOverTime()
 	if err != nil {
 		return err
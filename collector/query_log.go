@@ -0,0 +1,257 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"container/list"
+	"flag"
+	"strings"
+	"sync"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queryLogPath       string
+	queryLogMaxClients int
+)
+
+// maxPendingQueries bounds the queries waiting for their answer. Queries
+// answered without an outcome line, e.g. from /etc/hosts, are never
+// answered, the oldest query is dropped once it is reached
+const maxPendingQueries = 10000
+
+// queryLogOtherClient labels the queries of the clients above the limit
+const queryLogOtherClient = "other"
+
+// outcomes of the queries logged by dnsmasq, the values are the label values
+var queryLogOutcomes = map[string]string{
+	"reply":               "reply",
+	"cached":              "cached",
+	"gravity blocked":     "gravity_blocked",
+	"regex blacklisted":   "regex_blacklisted",
+	"exactly blacklisted": "exactly_blacklisted",
+}
+
+func init() {
+	registerCollector("query_log", defaultDisabled, newQueryLogCollector)
+
+	flag.StringVar(&queryLogPath, "collector.query_log.path", "/var/log/pihole.log", "Path of the dnsmasq query log of Pi-hole.")
+	flag.IntVar(
+		&queryLogMaxClients,
+		"collector.query_log.max-clients",
+		100,
+		"Clients counted separately by the query_log collector, the queries of further ones are counted as \"other\" (0 disables the counts by client).")
+}
+
+// queryLogCollector counts the queries logged to pihole.log since the
+// exporter started. The counters are exact regardless of the daily
+// totals of the socket API
+type queryLogCollector struct {
+	sync.Mutex
+	tail *logTail
+
+	queries   *prometheus.CounterVec
+	clients   *prometheus.CounterVec
+	outcomes  *prometheus.CounterVec
+	forwarded *prometheus.CounterVec
+
+	// pending counts the queries waiting for their answer by query id,
+	// or by domain without `log-queries=extra`. dnsmasq logs a line for
+	// every record of an answer, only the first one is counted. The order
+	// keeps the pending queries from the oldest one
+	pending map[string]*list.Element
+	order   *list.List
+
+	maxClients  int
+	seenClients map[string]bool
+}
+
+func newQueryLogCollector() (Collector, error) {
+	return newQueryLog(queryLogPath, queryLogMaxClients), nil
+}
+
+func newQueryLog(path string, maxClients int) *queryLogCollector {
+	return &queryLogCollector{
+		tail:        newLogTail(path, nil),
+		pending:     make(map[string]*list.Element),
+		order:       list.New(),
+		maxClients:  maxClients,
+		seenClients: make(map[string]bool),
+
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "query_log",
+			Name:      "queries_total",
+			Help:      "Queries logged by type.",
+		}, []string{"type"}),
+
+		clients: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "query_log",
+			Name:      "client_queries_total",
+			Help:      "Queries logged by client.",
+		}, []string{"client"}),
+
+		outcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "query_log",
+			Name:      "answers_total",
+			Help:      "Answers logged by outcome.",
+		}, []string{"outcome"}),
+
+		forwarded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "query_log",
+			Name:      "forwarded_total",
+			Help:      "Queries logged as forwarded by upstream server.",
+		}, []string{"upstream"}),
+	}
+}
+
+func (c *queryLogCollector) update(_ client.FTLAPI, ch chan<- prometheus.Metric) error {
+	c.Lock()
+	defer c.Unlock()
+
+	lines, err := c.tail.lines()
+	for _, line := range lines {
+		c.parse(line)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.queries.Collect(ch)
+	if c.maxClients > 0 {
+		c.clients.Collect(ch)
+	}
+	c.outcomes.Collect(ch)
+	c.forwarded.Collect(ch)
+
+	return nil
+}
+
+// parse counts a line such as
+// `Oct 18 10:00:00 dnsmasq[612]: query[A] example.com from 192.168.1.2`.
+// With `log-queries=extra` the message starts with the query id and
+// the address of the client, e.g. `1234 192.168.1.2/53124 query[A] ...`
+func (c *queryLogCollector) parse(line string) {
+	i := strings.Index(line, "]: ")
+	if i < 0 {
+		return
+	}
+	message := line[i+3:]
+
+	fields := strings.Fields(message)
+	var id string
+	if len(fields) > 2 && isQueryID(fields[0]) && strings.Contains(fields[1], "/") {
+		id = fields[0]
+		fields = fields[2:]
+	}
+
+	switch {
+	case len(fields) == 4 && strings.HasPrefix(fields[0], "query[") && fields[2] == "from":
+		c.queries.WithLabelValues(strings.TrimSuffix(strings.TrimPrefix(fields[0], "query["), "]")).Inc()
+		c.countClient(fields[3])
+		c.query(pendingKey(id, fields[1]))
+	case len(fields) == 4 && fields[0] == "forwarded" && fields[2] == "to":
+		c.forwarded.WithLabelValues(fields[3]).Inc()
+	case len(fields) >= 3:
+		outcome, ok := queryLogOutcomes[fields[0]]
+		name := fields[1]
+		if !ok && len(fields) >= 4 {
+			outcome, ok = queryLogOutcomes[fields[0]+" "+fields[1]]
+			name = fields[2]
+		}
+		if ok && c.answer(pendingKey(id, name)) {
+			c.outcomes.WithLabelValues(outcome).Inc()
+		}
+	}
+}
+
+// countClient counts the query of the client unless the limit of clients
+// has been reached, the queries of further clients are counted as other
+func (c *queryLogCollector) countClient(address string) {
+	if c.maxClients <= 0 {
+		return
+	}
+
+	if !c.seenClients[address] {
+		if len(c.seenClients) >= c.maxClients {
+			address = queryLogOtherClient
+		} else {
+			c.seenClients[address] = true
+		}
+	}
+	c.clients.WithLabelValues(address).Inc()
+}
+
+// pendingQuery is a query waiting for its answer
+type pendingQuery struct {
+	key   string
+	count int
+}
+
+// query records the query waiting for its answer
+func (c *queryLogCollector) query(key string) {
+	if element, ok := c.pending[key]; ok {
+		element.Value.(*pendingQuery).count++
+		c.order.MoveToBack(element)
+
+		return
+	}
+
+	if len(c.pending) >= maxPendingQueries {
+		oldest := c.order.Remove(c.order.Front()).(*pendingQuery)
+		delete(c.pending, oldest.key)
+	}
+	c.pending[key] = c.order.PushBack(&pendingQuery{key: key, count: 1})
+}
+
+// answer reports whether the answer is the first one to a pending query
+func (c *queryLogCollector) answer(key string) bool {
+	element, ok := c.pending[key]
+	if !ok {
+		return false
+	}
+
+	if query := element.Value.(*pendingQuery); query.count > 1 {
+		query.count--
+	} else {
+		c.order.Remove(element)
+		delete(c.pending, key)
+	}
+
+	return true
+}
+
+func pendingKey(id string, name string) string {
+	if id != "" {
+		return id
+	}
+
+	return name
+}
+
+// isQueryID reports whether the field is the query id logged with `log-queries=extra`
+func isQueryID(field string) bool {
+	for _, r := range field {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return field != ""
+}
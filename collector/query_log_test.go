@@ -0,0 +1,171 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueryLogCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_query_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pihole.log")
+	appendFile(t, path, "Oct 18 09:59:59 dnsmasq[612]: query[A] old.example.com from 192.168.1.2\n")
+
+	c := &testCollector{collector: newQueryLog(path, 100)}
+	if err := testutil.CollectAndCompare(c, strings.NewReader("")); err != nil {
+		t.Error(err)
+	}
+
+	appendFile(t, path, `Oct 18 10:00:00 dnsmasq[612]: query[A] example.com from 192.168.1.2
+Oct 18 10:00:00 dnsmasq[612]: forwarded example.com to 8.8.8.8
+Oct 18 10:00:00 dnsmasq[612]: reply example.com is 93.184.216.34
+Oct 18 10:00:01 dnsmasq[612]: query[AAAA] example.com from 192.168.1.3
+Oct 18 10:00:01 dnsmasq[612]: cached example.com is NODATA-IPv6
+Oct 18 10:00:02 dnsmasq[612]: query[A] ads.example.com from 192.168.1.2
+Oct 18 10:00:02 dnsmasq[612]: gravity blocked ads.example.com is 0.0.0.0
+Oct 18 10:00:03 dnsmasq[612]: query[A] tracker.example.com from 192.168.1.3
+Oct 18 10:00:03 dnsmasq[612]: regex blacklisted tracker.example.com is 0.0.0.0
+Oct 18 10:00:04 dnsmasq[612]: started, version pi-hole-2.81 cachesize 10000
+`)
+
+	want := `
+# HELP ftl_query_log_answers_total Answers logged by outcome.
+# TYPE ftl_query_log_answers_total counter
+ftl_query_log_answers_total{outcome="cached"} 1
+ftl_query_log_answers_total{outcome="gravity_blocked"} 1
+ftl_query_log_answers_total{outcome="regex_blacklisted"} 1
+ftl_query_log_answers_total{outcome="reply"} 1
+# HELP ftl_query_log_client_queries_total Queries logged by client.
+# TYPE ftl_query_log_client_queries_total counter
+ftl_query_log_client_queries_total{client="192.168.1.2"} 2
+ftl_query_log_client_queries_total{client="192.168.1.3"} 2
+# HELP ftl_query_log_forwarded_total Queries logged as forwarded by upstream server.
+# TYPE ftl_query_log_forwarded_total counter
+ftl_query_log_forwarded_total{upstream="8.8.8.8"} 1
+# HELP ftl_query_log_queries_total Queries logged by type.
+# TYPE ftl_query_log_queries_total counter
+ftl_query_log_queries_total{type="A"} 3
+ftl_query_log_queries_total{type="AAAA"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if c.err != nil {
+		t.Error(c.err)
+	}
+}
+
+func TestQueryLogCollector_answers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_query_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pihole.log")
+	appendFile(t, path, "")
+
+	c := &testCollector{collector: newQueryLog(path, 2)}
+	if err := testutil.CollectAndCompare(c, strings.NewReader("")); err != nil {
+		t.Error(err)
+	}
+
+	// a CNAME chain and several addresses are logged as a reply per record,
+	// the ids of log-queries=extra tell concurrent queries of a domain apart
+	appendFile(t, path, `Oct 18 10:00:00 dnsmasq[612]: query[A] www.example.com from 192.168.1.2
+Oct 18 10:00:00 dnsmasq[612]: forwarded www.example.com to 8.8.8.8
+Oct 18 10:00:00 dnsmasq[612]: reply www.example.com is <CNAME>
+Oct 18 10:00:00 dnsmasq[612]: reply cdn.example.net is 93.184.216.34
+Oct 18 10:00:00 dnsmasq[612]: reply cdn.example.net is 93.184.216.35
+Oct 18 10:00:01 dnsmasq[612]: query[A] example.org from 192.168.1.3
+Oct 18 10:00:01 dnsmasq[612]: cached example.org is 93.184.216.36
+Oct 18 10:00:01 dnsmasq[612]: cached example.org is 93.184.216.37
+Oct 18 10:00:02 dnsmasq[612]: 41 192.168.1.4/53124 query[A] example.com from 192.168.1.4
+Oct 18 10:00:02 dnsmasq[612]: 42 192.168.1.4/53125 query[AAAA] example.com from 192.168.1.4
+Oct 18 10:00:02 dnsmasq[612]: 41 192.168.1.4/53124 cached example.com is 93.184.216.34
+Oct 18 10:00:02 dnsmasq[612]: 41 192.168.1.4/53124 cached example.com is 93.184.216.35
+Oct 18 10:00:02 dnsmasq[612]: 42 192.168.1.4/53125 cached example.com is 2606:2800:220:1::1
+Oct 18 10:00:03 dnsmasq[612]: reply unrequested.example.com is 10.0.0.1
+`)
+
+	want := `
+# HELP ftl_query_log_answers_total Answers logged by outcome.
+# TYPE ftl_query_log_answers_total counter
+ftl_query_log_answers_total{outcome="cached"} 3
+ftl_query_log_answers_total{outcome="reply"} 1
+# HELP ftl_query_log_client_queries_total Queries logged by client.
+# TYPE ftl_query_log_client_queries_total counter
+ftl_query_log_client_queries_total{client="192.168.1.2"} 1
+ftl_query_log_client_queries_total{client="192.168.1.3"} 1
+ftl_query_log_client_queries_total{client="other"} 2
+# HELP ftl_query_log_forwarded_total Queries logged as forwarded by upstream server.
+# TYPE ftl_query_log_forwarded_total counter
+ftl_query_log_forwarded_total{upstream="8.8.8.8"} 1
+# HELP ftl_query_log_queries_total Queries logged by type.
+# TYPE ftl_query_log_queries_total counter
+ftl_query_log_queries_total{type="A"} 3
+ftl_query_log_queries_total{type="AAAA"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// counts by client are disabled without limit
+	c = &testCollector{collector: newQueryLog(path, 0)}
+	if err := testutil.CollectAndCompare(c, strings.NewReader("")); err != nil {
+		t.Error(err)
+	}
+	appendFile(t, path, "Oct 18 10:00:04 dnsmasq[612]: query[A] example.com from 192.168.1.2\n")
+	want = `
+# HELP ftl_query_log_queries_total Queries logged by type.
+# TYPE ftl_query_log_queries_total counter
+ftl_query_log_queries_total{type="A"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryLogCollector_pendingLimit(t *testing.T) {
+	c := newQueryLog("", 0)
+	for i := 0; i <= maxPendingQueries; i++ {
+		c.query(strconv.Itoa(i))
+	}
+
+	// only the oldest query is dropped, the others wait for their answer
+	if len(c.pending) != maxPendingQueries || c.order.Len() != maxPendingQueries {
+		t.Errorf("pending = %d, order = %d, want %d", len(c.pending), c.order.Len(), maxPendingQueries)
+	}
+	if c.answer("0") {
+		t.Error("answer() to the oldest query should be dropped")
+	}
+	if !c.answer("1") || !c.answer(strconv.Itoa(maxPendingQueries)) {
+		t.Error("answer() to the other queries should be counted")
+	}
+	if c.answer("1") {
+		t.Error("answer() should count the first answer only")
+	}
+}
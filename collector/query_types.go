@@ -24,6 +24,7 @@ type queryTypesCollector struct {
 
 func init() {
 	registerCollector("query_types", defaultEnabled, newQueryTypesCollector)
+	registerMethods("query_types", "GetQueryTypes")
 }
 
 func newQueryTypesCollector() (Collector, error) {
@@ -36,7 +37,7 @@ func newQueryTypesCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *queryTypesCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *queryTypesCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	queryTypes, err := client.GetQueryTypes()
 	if err != nil {
 		return err
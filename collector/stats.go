@@ -33,6 +33,7 @@ type statsCollector struct {
 
 func init() {
 	registerCollector("stats", defaultEnabled, newStatsCollector)
+	registerMethods("stats", "GetStats")
 }
 
 func newStatsCollector() (Collector, error) {
@@ -99,7 +100,7 @@ func newStatsCollector() (Collector, error) {
 	}, nil
 }
 
-func (c *statsCollector) update(client *client.FTLClient, ch chan<- prometheus.Metric) error {
+func (c *statsCollector) update(client client.FTLAPI, ch chan<- prometheus.Metric) error {
 	stats, err := client.GetStats()
 	if err != nil {
 		return err
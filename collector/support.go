@@ -0,0 +1,100 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	unsupportedRetry time.Duration
+
+	scrapeSupportedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "supported"),
+		"ftl_exporter: Whether FTL supports the commands of a collector.",
+		[]string{"collector"}, nil,
+	)
+)
+
+func init() {
+	flag.DurationVar(
+		&unsupportedRetry,
+		"collector.unsupported-retry",
+		time.Hour,
+		"How long a collector is skipped after FTL has answered its command as unknown, e.g. until FTL is upgraded.")
+}
+
+// commandSupport remembers the collectors whose commands FTL has answered
+// as unknown ones. Such collectors are skipped until the retry interval
+// has passed, so that a command added by an FTL upgrade is picked up
+type commandSupport struct {
+	sync.Mutex
+	retry       time.Duration
+	unsupported map[string]time.Time
+}
+
+func newCommandSupport() *commandSupport {
+	return &commandSupport{
+		retry:       unsupportedRetry,
+		unsupported: make(map[string]time.Time),
+	}
+}
+
+// supported reports whether the collector may be run
+func (s *commandSupport) supported(name string) bool {
+	if s == nil {
+		return true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	since, ok := s.unsupported[name]
+	if !ok {
+		return true
+	}
+	if time.Since(since) >= s.retry {
+		delete(s.unsupported, name)
+
+		return true
+	}
+
+	return false
+}
+
+// check marks the collector as unsupported if FTL has answered its command
+// as an unknown one and returns the error of the collector otherwise.
+// Other failures, e.g. of the REST API, never mark a collector
+func (s *commandSupport) check(name string, err error) error {
+	if s == nil || !errors.Is(err, client.ErrUnsupported) {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.unsupported[name]; !ok {
+		log.Printf("Collector %s is not supported by FTL and is skipped for %s: %s", name, s.retry, err)
+		s.unsupported[name] = time.Now()
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// logTail reads the lines appended to a log file since the previous call.
+// It follows the file when logrotate renames or truncates it
+type logTail struct {
+	path    string
+	history func(line string)
+	file    *os.File
+	offset  int64
+	partial string
+	started bool
+}
+
+// newLogTail returns the tail of the file, the lines written before
+// the exporter started are passed to history if it is not nil
+func newLogTail(path string, history func(line string)) *logTail {
+	return &logTail{path: path, history: history}
+}
+
+// lines returns the complete lines appended since the previous call.
+// The file existing on the first call is read from its end, so the
+// lines written before the exporter started are skipped
+func (t *logTail) lines() ([]string, error) {
+	fromEnd := !t.started
+	t.started = true
+
+	if t.file == nil {
+		if err := t.open(fromEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	var lines []string
+	collect := func(line string) {
+		lines = append(lines, line)
+	}
+
+	if err := t.read(collect); err != nil {
+		return lines, err
+	}
+
+	current, err := t.file.Stat()
+	if err != nil {
+		return lines, err
+	}
+	info, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		// renamed without a new file yet, keep the old one
+		return lines, nil
+	}
+	if err != nil {
+		return lines, err
+	}
+
+	switch {
+	case !os.SameFile(info, current):
+		// the old file has been read to the end, continue with the new one
+		t.close()
+		if err := t.open(false); err != nil {
+			return lines, err
+		}
+	case info.Size() < t.offset:
+		// truncated in place, e.g. by copytruncate
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return lines, err
+		}
+		t.offset = 0
+		t.partial = ""
+	default:
+		return lines, nil
+	}
+
+	err = t.read(collect)
+
+	return lines, err
+}
+
+func (t *logTail) open(fromEnd bool) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+
+	t.file = file
+	t.offset = 0
+	t.partial = ""
+
+	if !fromEnd {
+		return nil
+	}
+
+	// the history is streamed, the log may be tens of MB
+	if t.history != nil {
+		return t.read(t.history)
+	}
+
+	t.offset, err = file.Seek(0, io.SeekEnd)
+
+	return err
+}
+
+// read passes the complete lines up to the end of the file to fn
+// and keeps the incomplete last one for the next call
+func (t *logTail) read(fn func(line string)) error {
+	reader := bufio.NewReader(t.file)
+	for {
+		line, err := reader.ReadString('\n')
+		t.offset += int64(len(line))
+		if err == io.EOF {
+			t.partial += line
+
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fn(strings.TrimRight(t.partial+line, "\r\n"))
+		t.partial = ""
+	}
+}
+
+func (t *logTail) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
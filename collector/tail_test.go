@@ -0,0 +1,86 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func appendFile(t *testing.T, path string, data string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftl_tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pihole.log")
+	appendFile(t, path, "history\n")
+
+	var history []string
+	tail := newLogTail(path, func(line string) { history = append(history, line) })
+	defer tail.close()
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"history is passed aside", func() {}, nil},
+		{"appended", func() { appendFile(t, path, "one\ntwo\nthr") }, []string{"one", "two"}},
+		{"completed", func() { appendFile(t, path, "ee\n") }, []string{"three"}},
+		{"renamed", func() {
+			appendFile(t, path, "four\n")
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, path, "five\n")
+		}, []string{"four", "five"}},
+		{"truncated", func() {
+			if err := ioutil.WriteFile(path, []byte("six\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"six"}},
+		{"removed", func() { os.Remove(path) }, nil},
+	}
+	for _, step := range steps {
+		step.change()
+		got, err := tail.lines()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: lines() got = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if !reflect.DeepEqual(history, []string{"history"}) {
+		t.Errorf("history got = %q", history)
+	}
+}
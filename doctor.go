@@ -0,0 +1,205 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/collector"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// slowQuery is the response time from which polling in background is recommended
+const slowQuery = time.Second
+
+// probe is the result of a single query run by the `doctor` command
+type probe struct {
+	duration time.Duration
+	err      error
+}
+
+func (p probe) status() string {
+	switch {
+	case p.err == nil:
+		return "ok"
+	case errors.Is(p.err, client.ErrUnsupported):
+		return "unsupported"
+	default:
+		return fmt.Sprintf("failed: %s", p.err)
+	}
+}
+
+// runDoctor implements the `doctor` command which probes every FTL command
+// and recommends the collector flags for the FTL version
+func runDoctor(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] doctor\n", os.Args[0])
+
+		return 2
+	}
+
+	out := os.Stdout
+	if apiAddress == "" && replayDir == "" {
+		if !checkSocket(out, socket) {
+			return 1
+		}
+	}
+
+	api, closeAPI, err := newFTLAPI()
+	if err != nil {
+		log.Println(err)
+
+		return 1
+	}
+	defer closeAPI()
+
+	if socketClient, ok := api.(*client.FTLClient); ok {
+		// the session limits the time of every command
+		session := socketClient.NewSession()
+		defer session.Close()
+		api = session
+	}
+
+	printVersion(out, api)
+
+	if !recommendFlags(out, probeQueries(out, api)) {
+		return 1
+	}
+
+	return 0
+}
+
+// probeQueries runs every query and prints its response time and status
+func probeQueries(out io.Writer, api client.FTLAPI) map[string]probe {
+	probes := make(map[string]probe)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\nQUERY\tTIME\tSTATUS")
+	for _, name := range queryNames() {
+		begin := time.Now()
+		_, err := queries[name].call(api)
+		p := probe{duration: time.Since(begin), err: err}
+		probes[name] = p
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, p.duration.Round(time.Microsecond), p.status())
+	}
+	if err := w.Flush(); err != nil {
+		log.Println(err)
+	}
+
+	return probes
+}
+
+// checkSocket reports the permissions of the socket and whether it accepts connections
+func checkSocket(out io.Writer, path string) bool {
+	fmt.Fprintln(out, "Socket:", path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintln(out, "  error:", err)
+
+		return false
+	}
+
+	groups, _ := os.Getgroups()
+	fmt.Fprintln(out, "  mode:", info.Mode())
+	fmt.Fprintf(out, "  exporter: uid %d, gid %d, groups %v\n", os.Getuid(), os.Getgid(), groups)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		fmt.Fprintln(out, "  connect:", err)
+		if errors.Is(err, os.ErrPermission) {
+			fmt.Fprintln(out, "  hint: run the exporter as a member of the group owning the socket, e.g. pihole")
+		}
+
+		return false
+	}
+	_ = conn.Close()
+	fmt.Fprintln(out, "  connect: ok")
+
+	return true
+}
+
+func printVersion(out io.Writer, api client.FTLAPI) {
+	versioned, ok := api.(interface {
+		GetVersion() (*client.Version, error)
+	})
+	if !ok {
+		return
+	}
+
+	version, err := versioned.GetVersion()
+	if err != nil {
+		fmt.Fprintln(out, "FTL version:", probe{err: err}.status())
+
+		return
+	}
+
+	fmt.Fprintf(out, "FTL version: %s (branch %s, hash %s, date %s)\n",
+		version.Version, version.Branch, version.Hash, version.Date)
+}
+
+// recommendFlags prints the flags matching the collectors to the results
+// of the probes and reports whether all enabled collectors work
+func recommendFlags(out io.Writer, probes map[string]probe) bool {
+	states := collector.States()
+	collectors := collectorQueries()
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	healthy := true
+	var flags []string
+	for _, name := range names {
+		works, slow := true, false
+		for _, query := range collectors[name] {
+			p := probes[query]
+			works = works && p.err == nil
+			slow = slow || p.duration >= slowQuery
+		}
+
+		enabled := states[name]
+		switch {
+		case works && !enabled:
+			flags = append(flags, fmt.Sprintf("--collector.%s", name))
+		case !works && enabled:
+			flags = append(flags, fmt.Sprintf("--collector.%s=false", name))
+			healthy = false
+		}
+		if works && slow {
+			flags = append(flags, fmt.Sprintf("--collector.%s.poll-interval=1m", name))
+		}
+	}
+
+	if len(flags) == 0 {
+		fmt.Fprintln(out, "\nThe enabled collectors match the FTL commands.")
+
+		return healthy
+	}
+
+	fmt.Fprintln(out, "\nRecommended flags:")
+	for _, flag := range flags {
+		fmt.Fprintln(out, " ", flag)
+	}
+
+	return healthy
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/ftltest"
+)
+
+// unsupportedQueryTypes is FTL without `>querytypes`
+type unsupportedQueryTypes struct {
+	*client.Fake
+}
+
+func (unsupportedQueryTypes) GetQueryTypes() (*map[string]float32, error) {
+	return nil, client.ErrUnsupported
+}
+
+func TestProbeQueries(t *testing.T) {
+	fake := ftltest.Fake()
+	fake.DBStats = nil
+
+	var out bytes.Buffer
+	probes := probeQueries(&out, unsupportedQueryTypes{fake})
+
+	tests := []struct {
+		query  string
+		status string
+	}{
+		{"stats", "ok"},
+		{"query-types", "unsupported"},
+		{"db-stats", "failed: no response configured"},
+	}
+	for _, tt := range tests {
+		if status := probes[tt.query].status(); status != tt.status {
+			t.Errorf("%s status = %q, want %q", tt.query, status, tt.status)
+		}
+		if !strings.Contains(out.String(), tt.status) {
+			t.Errorf("output misses %q:\n%s", tt.status, out.String())
+		}
+	}
+	if len(probes) != len(queries) {
+		t.Errorf("probes = %d, want %d", len(probes), len(queries))
+	}
+}
+
+func TestRecommendFlags(t *testing.T) {
+	working := func() map[string]probe {
+		probes := make(map[string]probe)
+		for _, name := range queryNames() {
+			probes[name] = probe{duration: time.Millisecond}
+		}
+
+		return probes
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(probes map[string]probe)
+		want    []string
+		healthy bool
+	}{
+		{
+			name:    "all queries work",
+			modify:  func(probes map[string]probe) {},
+			want:    []string{"--collector.clients_over_time\n", "--collector.db_stats\n"},
+			healthy: true,
+		},
+		{
+			name: "enabled collector unsupported",
+			modify: func(probes map[string]probe) {
+				probes["query-types"] = probe{err: client.ErrUnsupported}
+			},
+			want:    []string{"--collector.query_types=false\n"},
+			healthy: false,
+		},
+		{
+			name: "one query of a collector fails",
+			modify: func(probes map[string]probe) {
+				probes["top-blocked-clients"] = probe{err: errors.New("connection reset")}
+			},
+			want:    []string{"--collector.clients=false\n"},
+			healthy: false,
+		},
+		{
+			name: "slow query",
+			modify: func(probes map[string]probe) {
+				probes["queries-over-time"] = probe{duration: 2 * time.Second}
+			},
+			want:    []string{"--collector.queries_over_time.poll-interval=1m\n"},
+			healthy: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := working()
+			tt.modify(probes)
+
+			var out bytes.Buffer
+			if healthy := recommendFlags(&out, probes); healthy != tt.healthy {
+				t.Errorf("recommendFlags() = %v, want %v", healthy, tt.healthy)
+			}
+			for _, flag := range tt.want {
+				if !strings.Contains(out.String(), flag) {
+					t.Errorf("recommendFlags() misses %q:\n%s", flag, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	if checkSocket(&out, filepath.Join(dir, "FTL.sock")) {
+		t.Error("checkSocket() = true for missing socket")
+	}
+
+	server, err := ftltest.NewUnixServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	out.Reset()
+	if !checkSocket(&out, server.Addr()) {
+		t.Errorf("checkSocket() = false:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "connect: ok") {
+		t.Errorf("checkSocket() output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ftltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/opensrcit/ftl_exporter/client"
+)
+
+const (
+	formatUint8   uint8 = 0xcc
+	formatUint16  uint8 = 0xcd
+	formatFloat32 uint8 = 0xca
+	formatUint32  uint8 = 0xd2
+	formatInt64   uint8 = 0xd3
+	formatString  uint8 = 0xdb
+	formatMap16   uint8 = 0xde
+
+	// FormatEOF terminates every response
+	FormatEOF uint8 = 0xc1
+)
+
+// encoder writes values in the format of FTL socket API
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) value(format uint8, value interface{}) {
+	e.WriteByte(format)
+	_ = binary.Write(e, binary.BigEndian, value)
+}
+
+func (e *encoder) uint32(value uint32) {
+	e.value(formatUint32, value)
+}
+
+func (e *encoder) float32(value float32) {
+	e.value(formatFloat32, value)
+}
+
+func (e *encoder) string(value string) {
+	e.value(formatString, uint32(len(value)))
+	e.WriteString(value)
+}
+
+func (e *encoder) eom() []byte {
+	e.WriteByte(FormatEOF)
+
+	return e.Bytes()
+}
+
+// EncodeStats encodes the response of `>stats` command
+func EncodeStats(stats *client.Stats) []byte {
+	var e encoder
+	e.uint32(uint32(stats.DomainsBeingBlocked))
+	e.uint32(uint32(stats.DnsQueriesToday))
+	e.uint32(uint32(stats.AdsBlockedToday))
+	e.float32(stats.AdsPercentageToday)
+	e.uint32(uint32(stats.UniqueDomains))
+	e.uint32(uint32(stats.QueriesForwarded))
+	e.uint32(uint32(stats.QueriesCached))
+	e.uint32(uint32(stats.ClientsEverSeen))
+	e.uint32(uint32(stats.UniqueClients))
+	e.value(formatUint8, uint8(stats.Status))
+
+	return e.eom()
+}
+
+// EncodeDBStats encodes the response of `>dbstats` command
+func EncodeDBStats(stats *client.DBStats) []byte {
+	var e encoder
+	e.uint32(stats.Rows.Value)
+	e.value(formatInt64, stats.Size.Value)
+
+	return e.eom()
+}
+
+// EncodeTopDomains encodes the response of `>top-domains` and `>top-ads` commands
+func EncodeTopDomains(entries *client.Entries) []byte {
+	var e encoder
+	e.uint32(entries.Total.Value)
+	for _, entry := range entries.List {
+		e.string(entry.Entry)
+		e.uint32(entry.Count)
+	}
+
+	return e.eom()
+}
+
+// EncodeTopClients encodes the response of `>top-clients` command.
+// Entries contain client addresses, names are left empty
+func EncodeTopClients(entries *client.Entries) []byte {
+	var e encoder
+	e.uint32(entries.Total.Value)
+	for _, entry := range entries.List {
+		e.string("")
+		e.string(entry.Entry)
+		e.uint32(entry.Count)
+	}
+
+	return e.eom()
+}
+
+// EncodeForwardDestinations encodes the response of `>forward-dest` command
+func EncodeForwardDestinations(destinations *[]client.UpstreamDestination) []byte {
+	var e encoder
+	for _, destination := range *destinations {
+		e.string(destination.Name)
+		e.string(destination.Address)
+		e.float32(destination.Percentage)
+	}
+
+	return e.eom()
+}
+
+// EncodeQueryTypes encodes the response of `>querytypes` command
+func EncodeQueryTypes(queryTypes *map[string]float32) []byte {
+	names := make([]string, 0, len(*queryTypes))
+	for name := range *queryTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var e encoder
+	for _, name := range names {
+		e.string(name)
+		e.float32((*queryTypes)[name])
+	}
+
+	return e.eom()
+}
+
+// EncodeQueriesOverTime encodes the response of `>overTime` command
+func EncodeQueriesOverTime(overTime *client.OverTime) []byte {
+	var e encoder
+	for _, list := range [][]client.TimestampCount{overTime.Forwarded, overTime.Blocked} {
+		e.value(formatMap16, uint16(len(list)))
+		for _, slot := range list {
+			e.uint32(slot.Timestamp.Value)
+			e.uint32(slot.Count.Value)
+		}
+	}
+
+	return e.eom()
+}
+
+// EncodeClientsOverTime encodes the response of `>ClientsoverTime` command
+func EncodeClientsOverTime(timestamps *[]client.TimestampClients) []byte {
+	var e encoder
+	for _, slot := range *timestamps {
+		e.uint32(slot.Timestamp)
+		for _, count := range slot.Count {
+			e.value(formatUint32, count.Value)
+		}
+		e.value(formatUint32, int32(-1))
+	}
+
+	return e.eom()
+}
+
+// EncodeClientNames encodes the response of `>client-names` command
+func EncodeClientNames(clients *[]client.Client) []byte {
+	var e encoder
+	for _, c := range *clients {
+		e.string(c.Name)
+		e.string(c.Address)
+	}
+
+	return e.eom()
+}
+
+// EncodeVersion encodes the response of `>version` command
+func EncodeVersion(version *client.Version) []byte {
+	var e encoder
+	e.string(version.Version)
+	e.string(version.Tag)
+	e.string(version.Branch)
+	e.string(version.Hash)
+	e.string(version.Date)
+
+	return e.eom()
+}
+
+// EncodeUnknownCommand encodes the text FTL sends for the commands it does not know
+func EncodeUnknownCommand(command string) []byte {
+	var e encoder
+	e.WriteString("unknown command: " + command + "\n")
+
+	return e.eom()
+}
+
+// EncodeFake encodes every response set in the fake backend
+// and returns them by command
+func EncodeFake(fake *client.Fake) map[string][]byte {
+	responses := make(map[string][]byte)
+	if fake.Stats != nil {
+		responses[">stats"] = EncodeStats(fake.Stats)
+	}
+	if fake.DBStats != nil {
+		responses[">dbstats"] = EncodeDBStats(fake.DBStats)
+	}
+	if fake.TopDomains != nil {
+		responses[">top-domains"] = EncodeTopDomains(fake.TopDomains)
+	}
+	if fake.TopAds != nil {
+		responses[">top-ads"] = EncodeTopDomains(fake.TopAds)
+	}
+	if fake.TopClients != nil {
+		responses[">top-clients"] = EncodeTopClients(fake.TopClients)
+	}
+	if fake.TopBlockedClients != nil {
+		responses[">top-clients blocked"] = EncodeTopClients(fake.TopBlockedClients)
+	}
+	if fake.ForwardDestinations != nil {
+		responses[">forward-dest"] = EncodeForwardDestinations(fake.ForwardDestinations)
+	}
+	if fake.QueryTypes != nil {
+		responses[">querytypes"] = EncodeQueryTypes(fake.QueryTypes)
+	}
+	if fake.QueriesOverTime != nil {
+		responses[">overTime"] = EncodeQueriesOverTime(fake.QueriesOverTime)
+	}
+	if fake.ClientsOverTime != nil {
+		responses[">ClientsoverTime"] = EncodeClientsOverTime(fake.ClientsOverTime)
+	}
+	if fake.ClientNames != nil {
+		responses[">client-names"] = EncodeClientNames(fake.ClientNames)
+	}
+
+	return responses
+}
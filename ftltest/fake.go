@@ -0,0 +1,79 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ftltest
+
+import "github.com/opensrcit/ftl_exporter/client"
+
+// Fake returns the responses of a small Pi-hole shared by the tests.
+// Every call returns a new copy, so a test may modify it
+func Fake() *client.Fake {
+	dbStats := &client.DBStats{}
+	dbStats.Rows.Value = 123456
+	dbStats.Size.Value = 7340032
+
+	return &client.Fake{
+		Stats: &client.Stats{
+			DomainsBeingBlocked: 94821,
+			DnsQueriesToday:     3214,
+			AdsBlockedToday:     25,
+			AdsPercentageToday:  0.5,
+			UniqueDomains:       3679,
+			QueriesForwarded:    435,
+			QueriesCached:       2754,
+			ClientsEverSeen:     7,
+			UniqueClients:       5,
+			Status:              1,
+		},
+		DBStats:           dbStats,
+		TopDomains:        entries(3214, "example.com", 300, "example.org", 200),
+		TopAds:            entries(25, "ads.example.com", 20),
+		TopClients:        entries(3214, "192.168.1.2", 2000),
+		TopBlockedClients: entries(25, "192.168.1.3", 15),
+		ForwardDestinations: &[]client.UpstreamDestination{
+			{Name: "cache", Address: "cache", Percentage: 85.5},
+			{Name: "dns.google", Address: "8.8.8.8", Percentage: 14.5},
+		},
+		QueryTypes: &map[string]float32{"A (IPv4)": 75, "AAAA (IPv6)": 25},
+		QueriesOverTime: &client.OverTime{
+			Forwarded: []client.TimestampCount{timestampCount(1000, 10), timestampCount(1600, 12)},
+			Blocked:   []client.TimestampCount{timestampCount(1000, 1), timestampCount(1600, 2)},
+		},
+		ClientsOverTime: &[]client.TimestampClients{
+			{Timestamp: 1600, Count: []client.Int32Block{{Value: 3}, {Value: 4}}},
+			{Timestamp: 1000, Count: []client.Int32Block{{Value: 1}, {Value: 2}}},
+		},
+		ClientNames: &[]client.Client{{Name: "laptop", Address: "192.168.1.2"}},
+	}
+}
+
+func entries(total uint32, list ...interface{}) *client.Entries {
+	result := &client.Entries{}
+	result.Total.Value = total
+	for i := 0; i < len(list); i += 2 {
+		result.List = append(result.List, struct {
+			Entry string
+			Count uint32
+		}{Entry: list[i].(string), Count: uint32(list[i+1].(int))})
+	}
+
+	return result
+}
+
+func timestampCount(timestamp uint32, count uint32) client.TimestampCount {
+	var result client.TimestampCount
+	result.Timestamp.Value = timestamp
+	result.Count.Value = count
+
+	return result
+}
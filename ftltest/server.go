@@ -0,0 +1,267 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ftltest provides a scriptable fake of the FTL socket API
+// for tests and local development
+package ftltest
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+)
+
+// Fault changes the way the server answers a command
+type Fault struct {
+	// Delay postpones the response
+	Delay time.Duration
+	// Truncate sends only the first bytes of the response if positive
+	Truncate int
+	// WrongFormat replaces the first format byte of the response
+	WrongFormat bool
+	// Reset closes the connection instead of answering
+	Reset bool
+}
+
+// Server answers FTL commands with the configured responses. Commands
+// without response are answered as unknown ones, see EncodeUnknownCommand
+type Server struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	responses map[string][]byte
+	faults    map[string]Fault
+	commands  []string
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// NewServer starts the server listening on the address,
+// the network is either `unix` or `tcp`
+func NewServer(network string, address string) (*Server, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:  listener,
+		responses: make(map[string][]byte),
+		faults:    make(map[string]Fault),
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// NewUnixServer starts the server on a new socket in the temporary directory
+func NewUnixServer() (*Server, error) {
+	dir, err := ioutil.TempDir("", "ftltest")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewServer("unix", filepath.Join(dir, "FTL.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Addr returns the socket path or the TCP address of the server
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all open connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	if s.listener.Addr().Network() == "unix" {
+		os.RemoveAll(filepath.Dir(s.Addr()))
+	}
+
+	return err
+}
+
+// SetResponse sets the raw response to the command
+func (s *Server) SetResponse(command string, response []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[command] = response
+}
+
+// SetFake sets the responses encoded from the values of the fake backend
+func (s *Server) SetFake(fake *client.Fake) {
+	for command, response := range EncodeFake(fake) {
+		s.SetResponse(command, response)
+	}
+}
+
+// LoadFixtures sets the raw responses stored in the directory. The files
+// are named by client.CaptureName, so the captures of the exporter running
+// with `--debug.record-dir` are fixtures as well. The latest capture of
+// a command is used if there are several ones
+func (s *Server) LoadFixtures(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+client.CaptureExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		response, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		s.SetResponse(client.CaptureCommand(file), response)
+	}
+
+	return nil
+}
+
+// SetFault sets the fault for the command
+func (s *Server) SetFault(command string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[command] = fault
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = make(map[string]Fault)
+}
+
+// Commands returns the commands received by the server
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commands := make([]string, len(s.commands))
+	copy(commands, s.commands)
+
+	return commands
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// handle answers the commands of the connection until it is closed
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		command := strings.TrimSpace(string(buf[:n]))
+		if command == ">quit" {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		response, ok := s.responses[command]
+		fault := s.faults[command]
+		s.mu.Unlock()
+
+		if !ok {
+			response = EncodeUnknownCommand(command)
+		}
+
+		if !s.reply(conn, response, fault) {
+			return
+		}
+	}
+}
+
+// reply sends the response with the fault applied and
+// reports whether the connection is still usable
+func (s *Server) reply(conn net.Conn, response []byte, fault Fault) bool {
+	if fault.Delay > 0 {
+		time.Sleep(fault.Delay)
+	}
+
+	if fault.Reset {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			_ = tcp.SetLinger(0)
+		}
+
+		return false
+	}
+
+	if fault.WrongFormat && len(response) > 0 {
+		response = append([]byte{0xff}, response[1:]...)
+	}
+
+	if fault.Truncate > 0 && fault.Truncate < len(response) {
+		_, _ = conn.Write(response[:fault.Truncate])
+
+		return false
+	}
+
+	_, err := conn.Write(response)
+
+	return err == nil
+}
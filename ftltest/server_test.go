@@ -0,0 +1,243 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ftltest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+)
+
+func newTestServer(t *testing.T) (*Server, *client.FTLClient) {
+	server, err := NewUnixServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	c, err := client.NewClient(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, c
+}
+
+func TestServer_SetFake(t *testing.T) {
+	fake := Fake()
+	server, c := newTestServer(t)
+	server.SetFake(fake)
+
+	for _, api := range []client.FTLAPI{c, c.NewSession()} {
+		calls := []struct {
+			name string
+			call func() (interface{}, error)
+			want interface{}
+		}{
+			{"GetStats", func() (interface{}, error) { return api.GetStats() }, fake.Stats},
+			{"GetDBStats", func() (interface{}, error) { return api.GetDBStats() }, fake.DBStats},
+			{"GetTopDomains", func() (interface{}, error) { return api.GetTopDomains() }, fake.TopDomains},
+			{"GetTopClients", func() (interface{}, error) { return api.GetTopClients() }, fake.TopClients},
+			{"GetForwardDestinations", func() (interface{}, error) { return api.GetForwardDestinations() }, fake.ForwardDestinations},
+			{"GetQueryTypes", func() (interface{}, error) { return api.GetQueryTypes() }, fake.QueryTypes},
+			{"GetQueriesOverTime", func() (interface{}, error) { return api.GetQueriesOverTime() }, fake.QueriesOverTime},
+			{"GetClientsOverTime", func() (interface{}, error) { return api.GetClientsOverTime() }, fake.ClientsOverTime},
+			{"GetClientNames", func() (interface{}, error) { return api.GetClientNames() }, fake.ClientNames},
+		}
+		for _, tt := range calls {
+			got, err := tt.call()
+			if err != nil {
+				t.Errorf("%s() err = %v", tt.name, err)
+
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s() got = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestServer_SetFault(t *testing.T) {
+	server, c := newTestServer(t)
+	server.SetFake(Fake())
+
+	// fixed layout of `>stats` is read without checking the format bytes,
+	// a closed connection ends a list of `>forward-dest` as the end of message
+	faults := []struct {
+		command string
+		fault   Fault
+	}{
+		{">stats", Fault{Truncate: 10}},
+		{">stats", Fault{Reset: true}},
+		{">forward-dest", Fault{Truncate: 10}},
+		{">forward-dest", Fault{WrongFormat: true}},
+	}
+	for _, tt := range faults {
+		server.ClearFaults()
+		server.SetFault(tt.command, tt.fault)
+		_, statsErr := c.GetStats()
+		_, destinationsErr := c.GetForwardDestinations()
+		if statsErr == nil && destinationsErr == nil {
+			t.Errorf("%s with %+v should fail", tt.command, tt.fault)
+		}
+	}
+
+	server.SetFault(">stats", Fault{Delay: 50 * time.Millisecond})
+	begin := time.Now()
+	if _, err := c.GetStats(); err != nil {
+		t.Error(err)
+	}
+	if time.Since(begin) < 50*time.Millisecond {
+		t.Error("GetStats() should be delayed")
+	}
+
+	server.ClearFaults()
+	if _, err := c.GetStats(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServer_LoadFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftltest_fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := Fake()
+	for command, response := range EncodeFake(fake) {
+		if err := ioutil.WriteFile(filepath.Join(dir, client.CaptureName(command, time.Time{})), response, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, c := newTestServer(t)
+	if err := server.LoadFixtures(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fake.Stats) {
+		t.Errorf("GetStats() got = %v, want %v", got, fake.Stats)
+	}
+
+	if commands := server.Commands(); !reflect.DeepEqual(commands, []string{">stats"}) {
+		t.Errorf("Commands() got = %v", commands)
+	}
+}
+
+func TestServer_tcp(t *testing.T) {
+	server, err := NewServer("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	if server.Addr() == "" {
+		t.Error("Addr() should not be empty")
+	}
+}
+
+func TestServer_LoadFixtures_recorded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftltest_record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := Fake()
+	server, c := newTestServer(t)
+	server.SetFake(fake)
+	if err := c.SetRecordDir(dir, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	session := c.NewSession()
+	if _, err := session.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.GetClientsOverTime(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+client.CaptureExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("recorded files = %v, want 2", files)
+	}
+
+	replay, c := newTestServer(t)
+	if err := replay.LoadFixtures(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats, fake.Stats) {
+		t.Errorf("GetStats() got = %v, want %v", stats, fake.Stats)
+	}
+
+	clientsOverTime, err := c.GetClientsOverTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(clientsOverTime, fake.ClientsOverTime) {
+		t.Errorf("GetClientsOverTime() got = %v, want %v", clientsOverTime, fake.ClientsOverTime)
+	}
+}
+
+func TestServer_unknownCommand(t *testing.T) {
+	server, c := newTestServer(t)
+	server.SetFake(Fake())
+
+	version := &client.Version{Version: "v5.2", Tag: "v5.2", Branch: "master", Hash: "abcdef0", Date: "2020-10-18"}
+
+	session := c.NewSession()
+	defer session.Close()
+	for _, api := range []*client.FTLClient{c, session} {
+		if _, err := api.GetVersion(); err != client.ErrUnsupported {
+			t.Errorf("GetVersion() err = %v, want %v", err, client.ErrUnsupported)
+		}
+
+		// the connection stays usable after the unknown command
+		if _, err := api.GetStats(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	server.SetResponse(">version", EncodeVersion(version))
+	got, err := session.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, version) {
+		t.Errorf("GetVersion() got = %v, want %v", got, version)
+	}
+}
@@ -2,4 +2,12 @@ module github.com/opensrcit/ftl_exporter
 
 go 1.14
 
-require github.com/prometheus/client_golang v1.1.0
+require (
+	github.com/golang/snappy v0.0.4
+	github.com/prometheus/client_golang v1.1.0
+	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
+	github.com/prometheus/common v0.6.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
+	gopkg.in/yaml.v2 v2.4.0
+)
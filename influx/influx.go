@@ -0,0 +1,142 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package influx encodes the metrics of the exporter in InfluxDB line protocol
+package influx
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Write encodes the metric families in line protocol, one line per metric.
+// The metric name is the measurement and the labels together with the extra
+// tags are tags. Counters, gauges and untyped metrics have the `value` field,
+// summaries and histograms are written as fields of their quantiles or
+// buckets, `sum` and `count` like Telegraf's prometheus input does
+func Write(w io.Writer, families []*dto.MetricFamily, tags map[string]string, now time.Time) error {
+	out := bufio.NewWriter(w)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			fields := metricFields(family.GetType(), metric)
+			if len(fields) == 0 {
+				continue
+			}
+
+			timestamp := now.UnixNano()
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs() * int64(time.Millisecond)
+			}
+
+			labels := make(map[string]string)
+			for key, value := range tags {
+				labels[key] = value
+			}
+			for _, pair := range metric.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+
+			writeLine(out, family.GetName(), labels, fields, timestamp)
+		}
+	}
+
+	return out.Flush()
+}
+
+type field struct {
+	key   string
+	value float64
+}
+
+func metricFields(metricType dto.MetricType, metric *dto.Metric) []field {
+	var fields []field
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		fields = append(fields, field{"value", metric.Counter.GetValue()})
+	case dto.MetricType_GAUGE:
+		fields = append(fields, field{"value", metric.Gauge.GetValue()})
+	case dto.MetricType_UNTYPED:
+		fields = append(fields, field{"value", metric.Untyped.GetValue()})
+	case dto.MetricType_SUMMARY:
+		for _, quantile := range metric.Summary.Quantile {
+			fields = append(fields, field{strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64), quantile.GetValue()})
+		}
+		fields = append(fields,
+			field{"sum", metric.Summary.GetSampleSum()},
+			field{"count", float64(metric.Summary.GetSampleCount())})
+	case dto.MetricType_HISTOGRAM:
+		for _, bucket := range metric.Histogram.Bucket {
+			fields = append(fields, field{strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64), float64(bucket.GetCumulativeCount())})
+		}
+		fields = append(fields,
+			field{"+Inf", float64(metric.Histogram.GetSampleCount())},
+			field{"sum", metric.Histogram.GetSampleSum()},
+			field{"count", float64(metric.Histogram.GetSampleCount())})
+	}
+
+	// line protocol has no representation of NaN and infinity
+	valid := fields[:0]
+	for _, f := range fields {
+		if !math.IsNaN(f.value) && !math.IsInf(f.value, 0) {
+			valid = append(valid, f)
+		}
+	}
+
+	return valid
+}
+
+func writeLine(out *bufio.Writer, measurement string, tags map[string]string, fields []field, timestamp int64) {
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		// empty tag values are not allowed
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out.WriteString(measurementEscaper.Replace(measurement))
+	for _, key := range keys {
+		out.WriteByte(',')
+		out.WriteString(keyEscaper.Replace(key))
+		out.WriteByte('=')
+		out.WriteString(keyEscaper.Replace(tags[key]))
+	}
+
+	for i, f := range fields {
+		if i == 0 {
+			out.WriteByte(' ')
+		} else {
+			out.WriteByte(',')
+		}
+		out.WriteString(keyEscaper.Replace(f.key))
+		out.WriteByte('=')
+		out.WriteString(strconv.FormatFloat(f.value, 'g', -1, 64))
+	}
+
+	out.WriteByte(' ')
+	out.WriteString(strconv.FormatInt(timestamp, 10))
+	out.WriteByte('\n')
+}
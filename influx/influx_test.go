@@ -0,0 +1,56 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influx
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWrite(t *testing.T) {
+	queries := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ftl_top_queries", Help: "Top queries."}, []string{"domain"})
+	queries.WithLabelValues("example.com").Set(300)
+	queries.WithLabelValues("with space,comma=equals").Set(1)
+
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ftl_client_command_duration_seconds",
+		Help:    "Round-trip time of FTL commands.",
+		Buckets: []float64{.1},
+	})
+	duration.Observe(.05)
+	duration.Observe(.5)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(queries, duration)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, families, map[string]string{"host": "pihole", "empty": ""}, time.Unix(1000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `ftl_client_command_duration_seconds,host=pihole 0.1=1,+Inf=2,sum=0.55,count=2 1000000000000
+ftl_top_queries,domain=example.com,host=pihole value=300 1000000000000
+ftl_top_queries,domain=with\ space\,comma\=equals,host=pihole value=1 1000000000000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Write() got:\n%s\nwant:\n%s", got, want)
+	}
+}
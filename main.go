@@ -14,12 +14,26 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"github.com/opensrcit/ftl_exporter/client"
 	"github.com/opensrcit/ftl_exporter/collector"
+	"github.com/opensrcit/ftl_exporter/mqtt"
+	"github.com/opensrcit/ftl_exporter/push"
 	"github.com/opensrcit/ftl_exporter/version"
+	"github.com/opensrcit/ftl_exporter/web"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -29,6 +43,30 @@ var (
 	listenAddress string
 	metricsPath   string
 	socket        string
+	webConfig     string
+
+	apiAddress            string
+	apiPasswordFile       string
+	apiInsecureSkipVerify bool
+
+	recordDir  string
+	recordKeep int
+	replayDir  string
+
+	pushConfig      push.Config
+	influxTokenFile string
+
+	output      string
+	outputExecd bool
+
+	textfileOutput string
+
+	mqttConfig             mqtt.Config
+	mqttPasswordFile       string
+	mqttCAFile             string
+	mqttCertFile           string
+	mqttKeyFile            string
+	mqttInsecureSkipVerify bool
 )
 
 func init() {
@@ -43,39 +81,425 @@ func init() {
 		"/metrics",
 		"Address on which to expose metrics and web interface.")
 	flag.StringVar(&socket, "socket", "/var/run/pihole/FTL.sock", "FTL socket path")
+	flag.StringVar(
+		&webConfig,
+		"web.config.file",
+		"",
+		"Path to configuration file that can enable TLS or authentication.")
+	flag.StringVar(
+		&apiAddress,
+		"api.address",
+		"",
+		"Address of the Pi-hole v6 web server, e.g. http://pi.hole. The REST API is used instead of the socket if set.")
+	flag.StringVar(
+		&apiPasswordFile,
+		"api.password-file",
+		"",
+		"Path to the file with the app password for the Pi-hole v6 REST API.")
+	flag.BoolVar(
+		&apiInsecureSkipVerify,
+		"api.insecure-skip-verify",
+		false,
+		"Skip verification of the Pi-hole v6 web server certificate.")
+	flag.StringVar(
+		&recordDir,
+		"debug.record-dir",
+		"",
+		"Directory to record every FTL command and its raw response into.")
+	flag.IntVar(
+		&recordKeep,
+		"debug.record-keep",
+		10,
+		"Number of the latest recorded responses kept for every FTL command.")
+	flag.StringVar(
+		&replayDir,
+		"debug.replay-dir",
+		"",
+		"Directory with recorded FTL responses to serve instead of the socket, requires a build with `-tags replay`.")
+
+	flag.StringVar(
+		&pushConfig.PushgatewayURL,
+		"push.gateway-url",
+		"",
+		"Pushgateway to push the metrics to, e.g. http://pushgateway:9091.")
+	flag.StringVar(
+		&pushConfig.RemoteWriteURL,
+		"push.remote-write-url",
+		"",
+		"Prometheus remote_write endpoint to push the metrics to, e.g. http://prometheus:9090/api/v1/write.")
+	flag.StringVar(
+		&pushConfig.OTLPURL,
+		"push.otlp-url",
+		"",
+		"OTLP/HTTP metrics endpoint to push the metrics to in JSON encoding, e.g. http://otel-collector:4318/v1/metrics.")
+	flag.StringVar(&pushConfig.InfluxURL, "push.influx-url", "", "InfluxDB v2 to write the metrics to, e.g. http://influxdb:8086.")
+	flag.StringVar(&pushConfig.InfluxOrg, "push.influx-org", "", "InfluxDB organization.")
+	flag.StringVar(&pushConfig.InfluxBucket, "push.influx-bucket", "pihole", "InfluxDB bucket.")
+	flag.StringVar(&influxTokenFile, "push.influx-token-file", "", "Path to the file with the InfluxDB API token.")
+	flag.StringVar(&pushConfig.Job, "push.job", "ftl_exporter", "Job label of the pushed metrics.")
+	flag.StringVar(&pushConfig.Instance, "push.instance", hostname(), "Instance label of the pushed metrics.")
+	flag.DurationVar(&pushConfig.Interval, "push.interval", time.Minute, "Interval between pushes.")
+	flag.IntVar(&pushConfig.Retries, "push.retries", 3, "Retries of a failed push.")
+	flag.DurationVar(&pushConfig.RetryBackoff, "push.retry-backoff", time.Second, "Delay before the first retry, doubled for every next one.")
+	flag.IntVar(
+		&pushConfig.BufferSize,
+		"push.buffer-size",
+		60,
+		"Pushes kept for remote_write while the endpoint is unavailable.")
+
+	flag.StringVar(
+		&output,
+		"output",
+		"",
+		"Write the metrics once to stdout in this format and exit instead of serving them: influx.")
+	flag.BoolVar(
+		&outputExecd,
+		"output.execd",
+		false,
+		"Write the metrics for every line read from stdin until it is closed, for Telegraf execd with signal STDIN.")
+
+	flag.StringVar(
+		&textfileOutput,
+		"textfile.output",
+		"",
+		"Write the metrics once into this file for the textfile collector of node_exporter and exit instead of serving them.")
+
+	flag.StringVar(
+		&mqttConfig.Broker,
+		"mqtt.broker",
+		"",
+		"MQTT broker to publish the statistics to, e.g. tcp://mqtt:1883 or ssl://mqtt:8883.")
+	flag.StringVar(&mqttConfig.Username, "mqtt.username", "", "MQTT user name.")
+	flag.StringVar(&mqttPasswordFile, "mqtt.password-file", "", "Path to the file with the MQTT password.")
+	flag.StringVar(&mqttConfig.ClientID, "mqtt.client-id", "", "MQTT client id (default: ftl_exporter_<node id>).")
+	flag.StringVar(&mqttConfig.NodeID, "mqtt.node-id", "", "Id of the Pi-hole in Home Assistant (default: host name).")
+	flag.StringVar(&mqttConfig.TopicPrefix, "mqtt.topic-prefix", "", "Prefix of the state topics (default: pihole/<node id>).")
+	flag.StringVar(
+		&mqttConfig.DiscoveryPrefix,
+		"mqtt.discovery-prefix",
+		"homeassistant",
+		"Home Assistant discovery prefix, empty disables discovery messages.")
+	flag.DurationVar(&mqttConfig.Interval, "mqtt.interval", time.Minute, "Interval between MQTT publishes.")
+	flag.StringVar(&mqttCAFile, "mqtt.ca-file", "", "CA certificate to verify the MQTT broker.")
+	flag.StringVar(&mqttCertFile, "mqtt.cert-file", "", "Client certificate for the MQTT broker.")
+	flag.StringVar(&mqttKeyFile, "mqtt.key-file", "", "Client certificate key for the MQTT broker.")
+	flag.BoolVar(&mqttInsecureSkipVerify, "mqtt.insecure-skip-verify", false, "Skip verification of the MQTT broker certificate.")
 
 	flag.Usage = func() {
 		fmt.Println("FTL Exporter", version.Version)
+		fmt.Printf("Usage: %s [flags] [query ... | doctor]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
+}
 
-	flag.Parse()
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
+
+var invalidNodeID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// configureMQTT completes the MQTT configuration with the defaults
+// derived from the host name, the password and the TLS files
+func configureMQTT() error {
+	if mqttConfig.NodeID == "" {
+		mqttConfig.NodeID = hostname()
+	}
+	mqttConfig.NodeID = invalidNodeID.ReplaceAllString(mqttConfig.NodeID, "_")
+	if mqttConfig.ClientID == "" {
+		mqttConfig.ClientID = "ftl_exporter_" + mqttConfig.NodeID
+	}
+	if mqttConfig.TopicPrefix == "" {
+		mqttConfig.TopicPrefix = "pihole/" + mqttConfig.NodeID
+	}
+
+	if mqttPasswordFile != "" {
+		content, err := ioutil.ReadFile(mqttPasswordFile)
+		if err != nil {
+			return err
+		}
+		mqttConfig.Password = strings.TrimSpace(string(content))
+	}
+
+	mqttConfig.TLS = &tls.Config{InsecureSkipVerify: mqttInsecureSkipVerify}
+	if mqttCAFile != "" {
+		content, err := ioutil.ReadFile(mqttCAFile)
+		if err != nil {
+			return err
+		}
+		mqttConfig.TLS.RootCAs = x509.NewCertPool()
+		if !mqttConfig.TLS.RootCAs.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificates in %s", mqttCAFile)
+		}
+	}
+	if mqttCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(mqttCertFile, mqttKeyFile)
+		if err != nil {
+			return err
+		}
+		mqttConfig.TLS.Certificates = []tls.Certificate{certificate}
+	}
+
+	return nil
+}
+
+// handler serves metrics of all enabled collectors or only of the ones
+// requested by `collect[]` query parameters
+type handler struct {
+	exporter          *collector.Exporter
+	unfilteredHandler http.Handler
+}
+
+func newHandler(exporter *collector.Exporter) *handler {
+	return &handler{
+		exporter:          exporter,
+		unfilteredHandler: promhttp.Handler(),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filters := r.URL.Query()["collect[]"]
+	if len(filters) == 0 {
+		h.unfilteredHandler.ServeHTTP(w, r)
+
+		return
+	}
+
+	filtered, err := h.exporter.Filter(filters...)
+	if err != nil {
+		log.Println("Couldn't create filtered metrics handler:", err)
+		http.Error(w, fmt.Sprintf("Couldn't create filtered metrics handler: %s", err), http.StatusBadRequest)
+
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(filtered); err != nil {
+		http.Error(w, fmt.Sprintf("Couldn't register filtered exporter: %s", err), http.StatusInternalServerError)
+
+		return
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// newFTLAPI creates the client for the REST API if its address is set
+// and for the socket otherwise. The returned function releases
+// the resources of the client, e.g. the replay server
+func newFTLAPI() (client.FTLAPI, func(), error) {
+	closeAPI := func() {}
+	if apiAddress == "" {
+		if replayDir != "" {
+			log.Printf("Replaying FTL responses from: %s", replayDir)
+
+			addr, closeReplay, err := startReplay(replayDir)
+			if err != nil {
+				return nil, nil, err
+			}
+			socket = addr
+			closeAPI = closeReplay
+		}
+
+		log.Printf("Initialize exporter using socket path: %s", socket)
+
+		ftlClient, err := client.NewClient(socket)
+		if err != nil {
+			closeAPI()
+
+			return nil, nil, err
+		}
+
+		if recordDir != "" {
+			log.Printf("Recording FTL responses into: %s", recordDir)
+
+			if err := ftlClient.SetRecordDir(recordDir, recordKeep); err != nil {
+				closeAPI()
+
+				return nil, nil, err
+			}
+		}
+
+		return ftlClient, closeAPI, nil
+	}
+
+	log.Printf("Initialize exporter using Pi-hole API: %s", apiAddress)
+
+	var password string
+	if apiPasswordFile != "" {
+		content, err := ioutil.ReadFile(apiPasswordFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		password = strings.TrimSpace(string(content))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: apiInsecureSkipVerify}
+
+	apiClient, err := client.NewAPIClient(apiAddress, password, &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return apiClient, closeAPI, nil
 }
 
 func main() {
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "":
+	case "query":
+		os.Exit(runQuery(flag.Args()[1:]))
+	case "doctor":
+		os.Exit(runDoctor(flag.Args()[1:]))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	os.Exit(run())
+}
+
+// run serves the metrics until SIGINT or SIGTERM is received,
+// or writes them once in the output and textfile modes
+func run() int {
 	log.Println("FTL Exporter", version.Version)
 
-	ftlExporter, err := collector.NewExporter(socket)
+	api, closeAPI, err := newFTLAPI()
 	if err != nil {
-		log.Fatalln(err)
+		log.Println(err)
 
-		return
+		return 1
 	}
+	defer closeAPI()
+
+	// the results of the collections are served by the snapshot API
+	recorder := client.NewRecorder(api)
+
+	ftlExporter, err := collector.NewExporter(recorder)
+	if err != nil {
+		log.Println(err)
+
+		return 1
+	}
+	if (output != "" || textfileOutput != "") && ftlExporter.Polled() {
+		log.Println("Polling in background can't be used with --output or --textfile.output, the metrics are collected once")
+
+		return 2
+	}
+	if output != "" {
+		return runOutput(ftlExporter, os.Stdin, os.Stdout)
+	}
+	if textfileOutput != "" {
+		return runTextfile(ftlExporter, textfileOutput)
+	}
+
 	prometheus.MustRegister(ftlExporter)
+	ftlExporter.StartPolling(nil)
+
+	// stop is closed on shutdown, the publishers wait for it to say goodbye
+	stop := make(chan struct{})
+	var publishers sync.WaitGroup
+
+	if mqttConfig.Broker != "" {
+		if err := configureMQTT(); err != nil {
+			log.Println(err)
+
+			return 1
+		}
+
+		log.Println("Publishing to MQTT broker", mqttConfig.Broker, "every", mqttConfig.Interval)
+
+		publishers.Add(1)
+		go func() {
+			defer publishers.Done()
+
+			mqtt.New(api, mqttConfig).Run(stop)
+		}()
+	}
+
+	if pushConfig.Enabled() {
+		log.Println("Pushing metrics every", pushConfig.Interval)
+
+		if influxTokenFile != "" {
+			content, err := ioutil.ReadFile(influxTokenFile)
+			if err != nil {
+				log.Println(err)
 
-	http.Handle(metricsPath, promhttp.Handler())
+				return 1
+			}
+			pushConfig.InfluxToken = strings.TrimSpace(string(content))
+		}
+
+		pushConfig.Resource = map[string]string{
+			"service.name":    pushConfig.Job,
+			"service.version": version.Version,
+			"host.name":       pushConfig.Instance,
+		}
+		if versioned, ok := api.(interface {
+			GetVersion() (*client.Version, error)
+		}); ok {
+			if ftlVersion, err := versioned.GetVersion(); err == nil {
+				pushConfig.Resource["ftl.version"] = ftlVersion.Version
+			} else {
+				log.Println("Failed to get FTL version:", err)
+			}
+		}
+
+		go push.New(prometheus.DefaultGatherer, pushConfig, nil).Run(nil)
+	}
+
+	http.Handle(metricsPath, newHandler(ftlExporter))
+	http.Handle(snapshotPath, &snapshotHandler{recorder: recorder})
+	http.Handle(snapshotPath+"/", &snapshotHandler{recorder: recorder})
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`<html lang="en">
              <head><title>FTL Exporter</title></head>
              <body>
              <h1>FTL Exporter</h1>
              <p><a href='/metrics'>Metrics</a></p>
+             <p><a href='/api/v1/snapshot'>Snapshot</a></p>
              </body>
              </html>`))
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
+	if webConfig != "" {
+		if err := web.ValidateConfig(webConfig); err != nil {
+			log.Println(err)
+
+			return 1
+		}
+	}
+
 	log.Println("Listening on", listenAddress)
-	log.Fatal(http.ListenAndServe(listenAddress, nil))
+	server := &http.Server{Addr: listenAddress}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Println("Shutting down")
+		close(stop)
+		server.Close()
+	}()
+
+	if err := web.ListenAndServe(server, webConfig); err != http.ErrServerClosed {
+		log.Println(err)
+
+		return 1
+	}
+	publishers.Wait()
+
+	return 0
 }
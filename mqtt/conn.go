@@ -0,0 +1,331 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// packet types of MQTT 3.1.1 used by the publisher
+const (
+	packetConnect    byte = 1 << 4
+	packetConnAck    byte = 2 << 4
+	packetPublish    byte = 3 << 4
+	packetPingReq    byte = 12 << 4
+	packetPingResp   byte = 13 << 4
+	packetDisconnect byte = 14 << 4
+)
+
+// connectTimeout limits connecting to the broker and every write
+const connectTimeout = 10 * time.Second
+
+var errPacketTooLarge = errors.New("packet too large")
+
+// will is the message published by the broker if the connection breaks
+type will struct {
+	topic   string
+	payload []byte
+}
+
+// conn is a minimal MQTT 3.1.1 client which publishes with QoS 0 only.
+// It pings the broker within the keep alive and reads its packets
+// in background to notice when the broker drops the connection
+type conn struct {
+	net.Conn
+	keepAlive time.Duration
+
+	// writes of the publisher and the pinger are serialized
+	writeMu sync.Mutex
+
+	// done is closed with err when reading from the broker fails
+	done chan struct{}
+	err  error
+	pong chan struct{}
+}
+
+// dial connects to the broker of the address `tcp://host:port`
+// or `ssl://host:port` and waits until it accepts the connection
+func dial(address string, tlsConfig *tls.Config, clientID string, username string, password string, keepAlive time.Duration, lastWill will) (*conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	var c net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		c, err = dialer.Dial("tcp", u.Host)
+	case "ssl", "tls", "mqtts":
+		c, err = tls.DialWithDialer(dialer, "tcp", u.Host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported scheme of %s", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the keep alive is sent in seconds
+	keepAlive = keepAlive.Truncate(time.Second)
+	if keepAlive > 0xffff*time.Second {
+		keepAlive = 0xffff * time.Second
+	}
+
+	mc := &conn{Conn: c, keepAlive: keepAlive, done: make(chan struct{}), pong: make(chan struct{}, 1)}
+	r := bufio.NewReader(c)
+	if err := mc.connect(r, clientID, username, password, keepAlive, lastWill); err != nil {
+		c.Close()
+
+		return nil, err
+	}
+
+	go mc.read(r)
+	if keepAlive > 0 {
+		go mc.ping()
+	}
+
+	return mc, nil
+}
+
+func (c *conn) connect(r *bufio.Reader, clientID string, username string, password string, keepAlive time.Duration, lastWill will) error {
+	var body bytes.Buffer
+	writeString(&body, []byte("MQTT"))
+	body.WriteByte(4) // protocol level of 3.1.1
+
+	// clean session and a retained will with QoS 0
+	flags := byte(0x02)
+	if lastWill.topic != "" {
+		flags |= 0x04 | 0x20
+	}
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	body.WriteByte(flags)
+
+	_ = binary.Write(&body, binary.BigEndian, uint16(keepAlive/time.Second))
+
+	writeString(&body, []byte(clientID))
+	if lastWill.topic != "" {
+		writeString(&body, []byte(lastWill.topic))
+		writeString(&body, lastWill.payload)
+	}
+	if username != "" {
+		writeString(&body, []byte(username))
+	}
+	if password != "" {
+		writeString(&body, []byte(password))
+	}
+
+	if err := c.write(packetConnect, body.Bytes()); err != nil {
+		return err
+	}
+
+	if err := c.SetReadDeadline(time.Now().Add(connectTimeout)); err != nil {
+		return err
+	}
+	packetType, ack, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if packetType != packetConnAck || len(ack) != 2 {
+		return fmt.Errorf("unexpected packet %#x instead of CONNACK", packetType)
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("connection refused by broker: %s", connAckReason(ack[1]))
+	}
+
+	return c.SetReadDeadline(time.Time{})
+}
+
+func connAckReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("code %d", code)
+	}
+}
+
+// read reads the packets of the broker until the connection breaks
+func (c *conn) read(r *bufio.Reader) {
+	for {
+		packetType, _, err := readPacket(r)
+		if err != nil {
+			c.err = err
+			close(c.done)
+
+			return
+		}
+
+		if packetType&0xf0 == packetPingResp {
+			select {
+			case c.pong <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// ping sends PINGREQ twice within the keep alive and closes the connection
+// if the broker does not answer until the next one
+func (c *conn) ping() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.write(packetPingReq, nil); err != nil {
+			c.Close()
+
+			return
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-c.pong:
+		case <-ticker.C:
+			c.Close()
+
+			return
+		}
+	}
+}
+
+// alive reports whether the broker keeps the connection, otherwise
+// it returns the error of reading from the broker
+func (c *conn) alive() (bool, error) {
+	select {
+	case <-c.done:
+		return false, c.err
+	default:
+		return true, nil
+	}
+}
+
+// publish sends the message with QoS 0
+func (c *conn) publish(topic string, payload []byte, retain bool) error {
+	header := packetPublish
+	if retain {
+		header |= 0x01
+	}
+
+	var body bytes.Buffer
+	writeString(&body, []byte(topic))
+	body.Write(payload)
+
+	return c.write(header, body.Bytes())
+}
+
+// disconnect closes the connection cleanly, the broker discards the will
+func (c *conn) disconnect() error {
+	_ = c.write(packetDisconnect, nil)
+
+	return c.Close()
+}
+
+func (c *conn) write(header byte, body []byte) error {
+	if len(body) > 268435455 {
+		return errPacketTooLarge
+	}
+
+	var packet bytes.Buffer
+	packet.WriteByte(header)
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet.WriteByte(b)
+		if length == 0 {
+			break
+		}
+	}
+	packet.Write(body)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.SetWriteDeadline(time.Now().Add(connectTimeout)); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(packet.Bytes())
+
+	return err
+}
+
+func writeString(w *bytes.Buffer, value []byte) {
+	_ = binary.Write(w, binary.BigEndian, uint16(len(value)))
+	w.Write(value)
+}
+
+// readPacket reads the packet type with its flags and the body of the next packet
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errPacketTooLarge
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header, body, nil
+}
@@ -0,0 +1,371 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mqtt publishes the FTL statistics to an MQTT broker together
+// with the discovery messages of Home Assistant
+package mqtt
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/version"
+)
+
+// Config of the publisher
+type Config struct {
+	// Broker is the address of the broker, e.g. tcp://mqtt:1883 or ssl://mqtt:8883
+	Broker   string
+	TLS      *tls.Config
+	ClientID string
+	Username string
+	Password string
+
+	// TopicPrefix is the prefix of the state topics, e.g. pihole/living-room
+	TopicPrefix string
+	// DiscoveryPrefix is the discovery prefix of Home Assistant,
+	// discovery is disabled if it is empty
+	DiscoveryPrefix string
+	// NodeID identifies the Pi-hole in unique ids of Home Assistant
+	NodeID string
+
+	Interval time.Duration
+}
+
+// Publisher publishes the statistics on every interval and reconnects
+// to the broker if the connection breaks
+type Publisher struct {
+	config Config
+	api    client.FTLAPI
+	conn   *conn
+}
+
+// New creates the publisher of the statistics from the backend
+func New(api client.FTLAPI, config Config) *Publisher {
+	config.TopicPrefix = strings.TrimSuffix(config.TopicPrefix, "/")
+
+	return &Publisher{config: config, api: api}
+}
+
+// Run publishes the statistics on every interval until stop is closed.
+// A nil channel keeps publishing forever
+func (p *Publisher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Publish(); err != nil {
+			log.Println("Failed to publish to MQTT:", err)
+		}
+
+		select {
+		case <-stop:
+			p.Close()
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close publishes the offline state and disconnects from the broker
+func (p *Publisher) Close() {
+	if p.conn == nil {
+		return
+	}
+
+	_ = p.conn.publish(p.topic("availability"), []byte("offline"), true)
+	_ = p.conn.disconnect()
+	p.conn = nil
+}
+
+func (p *Publisher) topic(name string) string {
+	return p.config.TopicPrefix + "/" + name
+}
+
+// Publish connects to the broker if needed and publishes the statistics once.
+// The connection is dropped if it fails and is reestablished by the next call
+func (p *Publisher) Publish() error {
+	if p.conn != nil {
+		if alive, err := p.conn.alive(); !alive {
+			log.Println("MQTT broker has closed the connection:", err)
+			p.drop()
+		}
+	}
+
+	if p.conn == nil {
+		c, err := dial(p.config.Broker, p.config.TLS, p.config.ClientID, p.config.Username, p.config.Password,
+			3*p.config.Interval, will{topic: p.topic("availability"), payload: []byte("offline")})
+		if err != nil {
+			return err
+		}
+		p.conn = c
+
+		if err := p.publishDiscovery(); err != nil {
+			p.drop()
+
+			return err
+		}
+	}
+
+	// the statistics which could be read are published anyway,
+	// but Home Assistant shows them as unavailable
+	availability := "online"
+	messages, err := p.states()
+	if err != nil {
+		log.Println("Failed to read FTL statistics for MQTT:", err)
+		availability = "offline"
+	}
+
+	messages[p.topic("availability")] = []byte(availability)
+	for topic, payload := range messages {
+		if err := p.conn.publish(topic, payload, true); err != nil {
+			p.drop()
+
+			return err
+		}
+	}
+
+	return err
+}
+
+func (p *Publisher) drop() {
+	_ = p.conn.Close()
+	p.conn = nil
+}
+
+// stats is the payload of the stats topic
+type stats struct {
+	DomainsBeingBlocked int     `json:"domains_being_blocked"`
+	DNSQueriesToday     int     `json:"dns_queries_today"`
+	AdsBlockedToday     int     `json:"ads_blocked_today"`
+	AdsPercentageToday  float32 `json:"ads_percentage_today"`
+	UniqueDomains       int     `json:"unique_domains"`
+	QueriesForwarded    int     `json:"queries_forwarded"`
+	QueriesCached       int     `json:"queries_cached"`
+	ClientsEverSeen     int     `json:"clients_ever_seen"`
+	UniqueClients       int     `json:"unique_clients"`
+}
+
+// topList is the payload of the top list topics, the entries
+// are the attributes of the sensor in Home Assistant
+type topList struct {
+	Total   uint32            `json:"total"`
+	Entries map[string]uint32 `json:"entries"`
+}
+
+func newTopList(entries *client.Entries) topList {
+	list := topList{Total: entries.Total.Value, Entries: make(map[string]uint32)}
+	for _, entry := range entries.List {
+		list.Entries[entry.Entry] = entry.Count
+	}
+
+	return list
+}
+
+// states reads the statistics and returns the payloads by topic
+func (p *Publisher) states() (map[string][]byte, error) {
+	messages := make(map[string][]byte)
+	var result error
+	add := func(topic string, value interface{}) {
+		payload, err := json.Marshal(value)
+		if err != nil {
+			result = err
+
+			return
+		}
+		messages[p.topic(topic)] = payload
+	}
+
+	if s, err := p.api.GetStats(); err != nil {
+		result = err
+	} else {
+		add("stats", stats{
+			DomainsBeingBlocked: s.DomainsBeingBlocked,
+			DNSQueriesToday:     s.DnsQueriesToday,
+			AdsBlockedToday:     s.AdsBlockedToday,
+			AdsPercentageToday:  s.AdsPercentageToday,
+			UniqueDomains:       s.UniqueDomains,
+			QueriesForwarded:    s.QueriesForwarded,
+			QueriesCached:       s.QueriesCached,
+			ClientsEverSeen:     s.ClientsEverSeen,
+			UniqueClients:       s.UniqueClients,
+		})
+
+		status := "disabled"
+		if s.Status == 1 {
+			status = "enabled"
+		}
+		messages[p.topic("status")] = []byte(status)
+	}
+
+	if domains, err := p.api.GetTopDomains(); err != nil {
+		result = err
+	} else {
+		add("top_domains", newTopList(domains))
+	}
+
+	if ads, err := p.api.GetTopAds(); err != nil {
+		result = err
+	} else {
+		add("top_ads", newTopList(ads))
+	}
+
+	if destinations, err := p.api.GetForwardDestinations(); err != nil {
+		result = err
+	} else {
+		percentages := make(map[string]float32)
+		for _, destination := range *destinations {
+			name := destination.Address
+			if destination.Name != "" {
+				name = destination.Name
+			}
+			percentages[name] = destination.Percentage
+		}
+		add("forward_destinations", map[string]interface{}{
+			"count":        len(*destinations),
+			"destinations": percentages,
+		})
+	}
+
+	return messages, result
+}
+
+// discovery is the config message of a Home Assistant entity
+type discovery struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	StateTopic          string          `json:"state_topic"`
+	ValueTemplate       string          `json:"value_template,omitempty"`
+	JSONAttributesTopic string          `json:"json_attributes_topic,omitempty"`
+	JSONAttributesTmpl  string          `json:"json_attributes_template,omitempty"`
+	UnitOfMeasurement   string          `json:"unit_of_measurement,omitempty"`
+	StateClass          string          `json:"state_class,omitempty"`
+	Icon                string          `json:"icon,omitempty"`
+	PayloadOn           string          `json:"payload_on,omitempty"`
+	PayloadOff          string          `json:"payload_off,omitempty"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	Device              discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version"`
+}
+
+// statsSensors are the sensors of the stats topic by field
+var statsSensors = []struct {
+	field string
+	name  string
+	unit  string
+	icon  string
+}{
+	{"domains_being_blocked", "Domains being blocked", "domains", "mdi:block-helper"},
+	{"dns_queries_today", "DNS queries today", "queries", "mdi:dns"},
+	{"ads_blocked_today", "Ads blocked today", "ads", "mdi:close-octagon"},
+	{"ads_percentage_today", "Ads percentage today", "%", "mdi:percent"},
+	{"unique_domains", "Unique domains", "domains", "mdi:domain"},
+	{"queries_forwarded", "Queries forwarded", "queries", "mdi:call-split"},
+	{"queries_cached", "Queries cached", "queries", "mdi:cached"},
+	{"clients_ever_seen", "Clients ever seen", "clients", "mdi:account-outline"},
+	{"unique_clients", "Unique clients", "clients", "mdi:account-multiple"},
+}
+
+// publishDiscovery publishes the retained config messages of all entities
+func (p *Publisher) publishDiscovery() error {
+	if p.config.DiscoveryPrefix == "" {
+		return nil
+	}
+
+	device := discoveryDevice{
+		Identifiers:  []string{"ftl_exporter_" + p.config.NodeID},
+		Name:         "Pi-hole " + p.config.NodeID,
+		Manufacturer: "Pi-hole",
+		Model:        "FTL",
+		SWVersion:    "ftl_exporter " + version.Version,
+	}
+	entity := func(component string, id string, config discovery) error {
+		config.UniqueID = p.config.NodeID + "_" + id
+		config.AvailabilityTopic = p.topic("availability")
+		config.Device = device
+
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", p.config.DiscoveryPrefix, component, p.config.NodeID, id)
+
+		return p.conn.publish(topic, payload, true)
+	}
+
+	for _, sensor := range statsSensors {
+		err := entity("sensor", sensor.field, discovery{
+			Name:              sensor.name,
+			StateTopic:        p.topic("stats"),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", sensor.field),
+			UnitOfMeasurement: sensor.unit,
+			StateClass:        "measurement",
+			Icon:              sensor.icon,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := entity("binary_sensor", "status", discovery{
+		Name:       "Blocking",
+		StateTopic: p.topic("status"),
+		PayloadOn:  "enabled",
+		PayloadOff: "disabled",
+		Icon:       "mdi:pi-hole",
+	})
+	if err != nil {
+		return err
+	}
+
+	lists := []struct{ id, name, icon string }{
+		{"top_domains", "Top domains", "mdi:web"},
+		{"top_ads", "Top ads", "mdi:advertisements-off"},
+	}
+	for _, list := range lists {
+		err := entity("sensor", list.id, discovery{
+			Name:                list.name,
+			StateTopic:          p.topic(list.id),
+			ValueTemplate:       "{{ value_json.total }}",
+			JSONAttributesTopic: p.topic(list.id),
+			JSONAttributesTmpl:  "{{ value_json.entries | tojson }}",
+			Icon:                list.icon,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return entity("sensor", "forward_destinations", discovery{
+		Name:                "Forward destinations",
+		StateTopic:          p.topic("forward_destinations"),
+		ValueTemplate:       "{{ value_json.count }}",
+		JSONAttributesTopic: p.topic("forward_destinations"),
+		JSONAttributesTmpl:  "{{ value_json.destinations | tojson }}",
+		Icon:                "mdi:server-network",
+	})
+}
@@ -0,0 +1,341 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/ftltest"
+)
+
+// broker accepts MQTT connections, records the retained messages
+// and answers pings
+type broker struct {
+	listener net.Listener
+	refuse   byte
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	connects [][]byte
+	pings    int
+	messages map[string][]byte
+	received chan struct{}
+}
+
+func newBroker(t *testing.T) *broker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{listener: listener, messages: make(map[string][]byte), received: make(chan struct{}, 1000)}
+	go b.serve()
+
+	return b
+}
+
+func (b *broker) address() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *broker) serve() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(c)
+	}
+}
+
+// decodePacket reads a packet independently of the client, the remaining
+// length of MQTT is encoded like an unsigned varint
+func decodePacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header, body, nil
+}
+
+// drop closes the connections of the clients like a restarted broker
+func (b *broker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.conns = nil
+}
+
+func (b *broker) handle(c net.Conn) {
+	defer c.Close()
+
+	b.mu.Lock()
+	b.conns = append(b.conns, c)
+	b.mu.Unlock()
+
+	r := bufio.NewReader(c)
+	for {
+		header, body, err := decodePacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header & 0xf0 {
+		case 1 << 4: // CONNECT
+			b.mu.Lock()
+			b.connects = append(b.connects, body)
+			b.mu.Unlock()
+			_, _ = c.Write([]byte{2 << 4, 2, 0, b.refuse})
+		case 12 << 4: // PINGREQ
+			b.mu.Lock()
+			b.pings++
+			b.mu.Unlock()
+			_, _ = c.Write([]byte{13 << 4, 0})
+		case 3 << 4: // PUBLISH
+			length := binary.BigEndian.Uint16(body)
+			topic := string(body[2 : 2+length])
+
+			b.mu.Lock()
+			b.messages[topic] = body[2+length:]
+			b.mu.Unlock()
+			b.received <- struct{}{}
+		case 14 << 4: // DISCONNECT
+			return
+		}
+	}
+}
+
+// message waits until the topic has been published
+func (b *broker) message(t *testing.T, topic string) []byte {
+	timeout := time.After(5 * time.Second)
+	for {
+		b.mu.Lock()
+		payload, ok := b.messages[topic]
+		b.mu.Unlock()
+		if ok {
+			return payload
+		}
+
+		select {
+		case <-b.received:
+		case <-timeout:
+			t.Fatalf("%s has not been published", topic)
+		}
+	}
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	b := newBroker(t)
+	defer b.listener.Close()
+
+	publisher := New(ftltest.Fake(), Config{
+		Broker:          b.address(),
+		ClientID:        "ftl_exporter",
+		Username:        "user",
+		Password:        "secret",
+		TopicPrefix:     "pihole/test/",
+		DiscoveryPrefix: "homeassistant",
+		NodeID:          "test",
+		Interval:        time.Minute,
+	})
+	if err := publisher.Publish(); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats map[string]interface{}
+	if err := json.Unmarshal(b.message(t, "pihole/test/stats"), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["dns_queries_today"] != float64(3214) {
+		t.Errorf("stats = %v", stats)
+	}
+
+	if status := string(b.message(t, "pihole/test/status")); status != "enabled" {
+		t.Errorf("status = %s", status)
+	}
+	if availability := string(b.message(t, "pihole/test/availability")); availability != "online" {
+		t.Errorf("availability = %s", availability)
+	}
+
+	var top topList
+	if err := json.Unmarshal(b.message(t, "pihole/test/top_domains"), &top); err != nil {
+		t.Fatal(err)
+	}
+	if top.Total != 3214 || top.Entries["example.com"] != 300 {
+		t.Errorf("top_domains = %+v", top)
+	}
+
+	var config discovery
+	if err := json.Unmarshal(b.message(t, "homeassistant/sensor/test/dns_queries_today/config"), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.StateTopic != "pihole/test/stats" || config.UniqueID != "test_dns_queries_today" {
+		t.Errorf("discovery = %+v", config)
+	}
+	b.message(t, "homeassistant/binary_sensor/test/status/config")
+
+	// the credentials and the will are sent with CONNECT
+	b.mu.Lock()
+	connect := b.connects[0]
+	b.mu.Unlock()
+	if flags := connect[7]; flags != 0x80|0x40|0x20|0x04|0x02 {
+		t.Errorf("connect flags = %#x", flags)
+	}
+
+	publisher.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for string(b.message(t, "pihole/test/availability")) != "offline" {
+		if time.Now().After(deadline) {
+			t.Fatal("offline availability has not been published by Close()")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublisher_refused(t *testing.T) {
+	b := newBroker(t)
+	defer b.listener.Close()
+	b.refuse = 5
+
+	publisher := New(ftltest.Fake(), Config{Broker: b.address(), ClientID: "ftl_exporter", TopicPrefix: "pihole", Interval: time.Minute})
+	if err := publisher.Publish(); err == nil || publisher.conn != nil {
+		t.Errorf("Publish() err = %v, want refused connection", err)
+	}
+}
+
+func TestConn_write(t *testing.T) {
+	// the fixtures are encoded by hand after the MQTT 3.1.1 specification
+	long := make([]byte, 200)
+	tests := []struct {
+		name    string
+		header  byte
+		body    []byte
+		want    []byte
+		wantLen int
+	}{
+		{name: "ping", header: packetPingReq, want: []byte{0xc0, 0x00}},
+		{name: "disconnect", header: packetDisconnect, want: []byte{0xe0, 0x00}},
+		{name: "publish", header: packetPublish | 0x01, body: []byte{0, 1, 'a', 'b'}, want: []byte{0x31, 0x04, 0, 1, 'a', 'b'}},
+		{name: "two length bytes", header: packetPublish, body: long, want: []byte{0x30, 0xc8, 0x01}, wantLen: 203},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			c := &conn{Conn: client}
+			go func() {
+				_ = c.write(tt.header, tt.body)
+				client.Close()
+			}()
+
+			got, err := ioutil.ReadAll(server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLen := tt.wantLen
+			if wantLen == 0 {
+				wantLen = len(tt.want)
+			}
+			if len(got) != wantLen || string(got[:len(tt.want)]) != string(tt.want) {
+				t.Errorf("write() got = %x, want %x with %d bytes", got, tt.want, wantLen)
+			}
+		})
+	}
+}
+
+func TestPublisher_keepAlive(t *testing.T) {
+	b := newBroker(t)
+	defer b.listener.Close()
+
+	// the keep alive of three intervals is sent as one second
+	publisher := New(ftltest.Fake(), Config{Broker: b.address(), ClientID: "ftl_exporter", TopicPrefix: "pihole", Interval: time.Second / 2})
+	defer publisher.Close()
+	if err := publisher.Publish(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.Lock()
+		pings := b.pings
+		b.mu.Unlock()
+		if pings > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("PINGREQ has not been sent within the keep alive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if alive, err := publisher.conn.alive(); !alive {
+		t.Errorf("alive() after ping = false: %v", err)
+	}
+
+	// the dropped connection is noticed and reestablished by the next publish
+	b.drop()
+	for {
+		if alive, _ := publisher.conn.alive(); !alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("dropped connection has not been noticed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := publisher.Publish(); err != nil {
+		t.Fatal(err)
+	}
+	b.mu.Lock()
+	connects := len(b.connects)
+	b.mu.Unlock()
+	if connects != 2 {
+		t.Errorf("connects = %d, want 2", connects)
+	}
+}
+
+func TestPublisher_unavailableFTL(t *testing.T) {
+	b := newBroker(t)
+	defer b.listener.Close()
+
+	publisher := New(&client.Fake{Err: client.ErrNoResponse}, Config{Broker: b.address(), ClientID: "ftl_exporter", TopicPrefix: "pihole", Interval: time.Minute})
+	defer publisher.Close()
+	if err := publisher.Publish(); err == nil {
+		t.Error("Publish() should fail without FTL")
+	}
+	if availability := string(b.message(t, "pihole/availability")); availability != "offline" {
+		t.Errorf("availability = %s, want offline", availability)
+	}
+}
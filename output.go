@@ -0,0 +1,172 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/collector"
+	"github.com/opensrcit/ftl_exporter/influx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// runOutput writes the metrics of the exporter to out once or,
+// in execd mode, for every line read from in
+func runOutput(exporter *collector.Exporter, in io.Reader, out io.Writer) int {
+	if output != "influx" {
+		fmt.Fprintln(os.Stderr, "Unknown output format:", output)
+
+		return 2
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(exporter); err != nil {
+		log.Println(err)
+
+		return 1
+	}
+
+	if !outputExecd {
+		failed, err := writeOutput(out, registry)
+		if err != nil {
+			log.Println("Failed to write metrics:", err)
+
+			return 1
+		}
+		if failed {
+			return 1
+		}
+
+		return 0
+	}
+
+	// a failed collector is run again for the next line,
+	// but the output is gone once a write fails
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if _, err := writeOutput(out, registry); err != nil {
+			log.Println("Failed to write metrics:", err)
+
+			return 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println(err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// writeOutput writes the metrics once and returns the error of the write.
+// The metrics are written even if a collector has failed, which is reported
+func writeOutput(out io.Writer, registry *prometheus.Registry) (bool, error) {
+	families, gatherErr := registry.Gather()
+	if gatherErr != nil {
+		log.Println(gatherErr)
+	}
+
+	if err := influx.Write(out, families, nil, time.Now()); err != nil {
+		return true, err
+	}
+
+	return gatherErr != nil || collectorsFailed(families), nil
+}
+
+// runTextfile runs the collectors once and writes their metrics into the file.
+// The file is replaced atomically, so the textfile collector of node_exporter
+// never reads a partial one. It fails if any collector has failed
+func runTextfile(exporter *collector.Exporter, path string) int {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(exporter); err != nil {
+		log.Println(err)
+
+		return 1
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if err := writeTextfile(path, families); err != nil {
+		log.Println("Failed to write textfile:", err)
+
+		return 1
+	}
+
+	if err != nil || collectorsFailed(families) {
+		return 1
+	}
+
+	return 0
+}
+
+// writeTextfile writes the metrics into a temporary file next to the path
+// and renames it, the rename is atomic within a file system
+func writeTextfile(path string, families []*dto.MetricFamily) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(tmp, family); err != nil {
+			tmp.Close()
+
+			return err
+		}
+	}
+
+	// node_exporter may run as another user
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// collectorsFailed reports whether any collector has reported its failure
+func collectorsFailed(families []*dto.MetricFamily) bool {
+	for _, family := range families {
+		if family.GetName() != "ftl_scrape_collector_success" {
+			continue
+		}
+
+		for _, metric := range family.Metric {
+			if metric.Gauge.GetValue() == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opensrcit/ftl_exporter/collector"
+	"github.com/opensrcit/ftl_exporter/ftltest"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// brokenWriter fails like stdout closed by the reader
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestRunOutput(t *testing.T) {
+	defer func(format string, execd bool) { output, outputExecd = format, execd }(output, outputExecd)
+
+	tests := []struct {
+		name   string
+		format string
+		execd  bool
+		in     string
+		failed bool
+		broken bool
+		status int
+		writes int
+	}{
+		{name: "once", format: "influx", status: 0, writes: 1},
+		{name: "once with failed collector", format: "influx", failed: true, status: 1, writes: 0},
+		{name: "once with failed write", format: "influx", broken: true, status: 1},
+		{name: "execd", format: "influx", execd: true, in: "\n\n", status: 0, writes: 2},
+		{name: "execd with failed collector", format: "influx", execd: true, in: "\n\n", failed: true, status: 0, writes: 0},
+		{name: "execd with failed write", format: "influx", execd: true, in: "\n\n", broken: true, status: 1},
+		{name: "execd without input", format: "influx", execd: true, status: 0, writes: 0},
+		{name: "unknown format", format: "json", status: 2, writes: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, outputExecd = tt.format, tt.execd
+
+			fake := ftltest.Fake()
+			if tt.failed {
+				fake.Stats = nil
+			}
+			exporter, err := collector.NewExporter(fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			var w io.Writer = &out
+			if tt.broken {
+				w = brokenWriter{}
+			}
+			if status := runOutput(exporter, strings.NewReader(tt.in), w); status != tt.status {
+				t.Errorf("runOutput() status = %d, want %d", status, tt.status)
+			}
+			if writes := strings.Count(out.String(), "ftl_dns_queries_today value=3214 "); writes != tt.writes {
+				t.Errorf("runOutput() wrote the stats %d times, want %d:\n%s", writes, tt.writes, out.String())
+			}
+			if tt.failed && !tt.execd && !strings.Contains(out.String(), "ftl_scrape_collector_success,collector=stats value=0 ") {
+				t.Errorf("runOutput() misses the failed collector:\n%s", out.String())
+			}
+		})
+	}
+}
+
+// successFamilies returns the gathered ftl_scrape_collector_success metrics
+func successFamilies(t *testing.T, success map[string]float64) []*dto.MetricFamily {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ftl_scrape_collector_success",
+		Help: "ftl_exporter: Whether a collector succeeded.",
+	}, []string{"collector"})
+	for name, value := range success {
+		gauge.WithLabelValues(name).Set(value)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return families
+}
+
+func TestCollectorsFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		success map[string]float64
+		want    bool
+	}{
+		{name: "no collectors", success: nil, want: false},
+		{name: "all succeeded", success: map[string]float64{"stats": 1, "clients": 1}, want: false},
+		{name: "one failed", success: map[string]float64{"stats": 1, "clients": 0}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectorsFailed(successFamilies(t, tt.success)); got != tt.want {
+				t.Errorf("collectorsFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ftl.prom")
+	if err := ioutil.WriteFile(path, []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeTextfile(path, successFamilies(t, map[string]float64{"stats": 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP ftl_scrape_collector_success ftl_exporter: Whether a collector succeeded.
+# TYPE ftl_scrape_collector_success gauge
+ftl_scrape_collector_success{collector="stats"} 1
+`
+	if string(content) != want {
+		t.Errorf("textfile got\n%s\nwant\n%s", content, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("textfile mode = %s, want 0644", info.Mode().Perm())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+func TestRunTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := ftltest.Fake()
+	exporter, err := collector.NewExporter(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "ftl.prom")
+	if status := runTextfile(exporter, path); status != 0 {
+		t.Errorf("runTextfile() status = %d, want 0", status)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "ftl_dns_queries_today 3214") {
+		t.Errorf("textfile misses stats:\n%s", content)
+	}
+
+	// a failed collector fails the run, but its metrics are written
+	fake.Stats = nil
+	if status := runTextfile(exporter, path); status != 1 {
+		t.Errorf("runTextfile() with failed collector status = %d, want 1", status)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/influx"
+	"github.com/opensrcit/ftl_exporter/version"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sendInflux writes the metrics in line protocol to the InfluxDB v2 write API
+func (p *Pusher) sendInflux(families []*dto.MetricFamily, now time.Time) error {
+	tags := map[string]string{"host": p.config.Instance}
+
+	var body bytes.Buffer
+	if err := influx.Write(&body, families, tags, now); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(p.config.InfluxURL, "/") + "/api/v2/write")
+	if err != nil {
+		return fmt.Errorf("%w: %s", errPermanent, err)
+	}
+	u.RawQuery = url.Values{
+		"org":       {p.config.InfluxOrg},
+		"bucket":    {p.config.InfluxBucket},
+		"precision": {"ns"},
+	}.Encode()
+
+	request, err := http.NewRequest(http.MethodPost, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	request.Header.Set("User-Agent", "ftl_exporter/"+version.Version)
+	if p.config.InfluxToken != "" {
+		request.Header.Set("Authorization", "Token "+p.config.InfluxToken)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := checkResponse(response); err != nil {
+		return fmt.Errorf("influx: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/opensrcit/ftl_exporter/version"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The types below are the JSON encoding of the OTLP metrics protocol.
+// 64-bit integers are encoded as strings as required by the protocol
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Gauge       *otlpData `json:"gauge,omitempty"`
+	Sum         *otlpData `json:"sum,omitempty"`
+	Histogram   *otlpData `json:"histogram,omitempty"`
+	Summary     *otlpData `json:"summary,omitempty"`
+}
+
+type otlpData struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality,omitempty"`
+	IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+
+	AsDouble *float64 `json:"asDouble,omitempty"`
+
+	Count          string         `json:"count,omitempty"`
+	Sum            *float64       `json:"sum,omitempty"`
+	BucketCounts   []string       `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64      `json:"explicitBounds,omitempty"`
+	QuantileValues []otlpQuantile `json:"quantileValues,omitempty"`
+}
+
+type otlpQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+const aggregationCumulative = 2
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		result[i].Key = key
+		result[i].Value.StringValue = attributes[key]
+	}
+
+	return result
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func count(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
+
+// newOTLPRequest translates the metric families into OTLP metrics. Counters
+// become cumulative monotonic sums started at start, histogram buckets
+// are converted from cumulative counts to the counts of every bucket
+func newOTLPRequest(families []*dto.MetricFamily, resource map[string]string, start time.Time, now time.Time) otlpRequest {
+	scope := otlpScopeMetrics{}
+	scope.Scope.Name = "ftl_exporter"
+	scope.Scope.Version = version.Version
+
+	for _, family := range families {
+		data := &otlpData{}
+		metric := otlpMetric{Name: family.GetName(), Description: family.GetHelp()}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			data.AggregationTemporality = aggregationCumulative
+			data.IsMonotonic = true
+			metric.Sum = data
+		case dto.MetricType_HISTOGRAM:
+			data.AggregationTemporality = aggregationCumulative
+			metric.Histogram = data
+		case dto.MetricType_SUMMARY:
+			metric.Summary = data
+		default:
+			metric.Gauge = data
+		}
+
+		for _, m := range family.Metric {
+			labels := make(map[string]string)
+			for _, pair := range m.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+
+			timestamp := now
+			if m.TimestampMs != nil {
+				timestamp = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+			}
+
+			point := otlpDataPoint{
+				Attributes:   otlpAttributes(labels),
+				TimeUnixNano: nanos(timestamp),
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value := m.Counter.GetValue()
+				point.StartTimeUnixNano = nanos(start)
+				point.AsDouble = &value
+			case dto.MetricType_GAUGE:
+				value := m.Gauge.GetValue()
+				point.AsDouble = &value
+			case dto.MetricType_UNTYPED:
+				value := m.Untyped.GetValue()
+				point.AsDouble = &value
+			case dto.MetricType_SUMMARY:
+				sum := m.Summary.GetSampleSum()
+				point.StartTimeUnixNano = nanos(start)
+				point.Count = count(m.Summary.GetSampleCount())
+				point.Sum = &sum
+				for _, quantile := range m.Summary.Quantile {
+					point.QuantileValues = append(point.QuantileValues,
+						otlpQuantile{Quantile: quantile.GetQuantile(), Value: quantile.GetValue()})
+				}
+			case dto.MetricType_HISTOGRAM:
+				sum := m.Histogram.GetSampleSum()
+				point.StartTimeUnixNano = nanos(start)
+				point.Count = count(m.Histogram.GetSampleCount())
+				point.Sum = &sum
+
+				var previous uint64
+				for _, bucket := range m.Histogram.Bucket {
+					point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+					point.BucketCounts = append(point.BucketCounts, count(bucket.GetCumulativeCount()-previous))
+					previous = bucket.GetCumulativeCount()
+				}
+				point.BucketCounts = append(point.BucketCounts, count(m.Histogram.GetSampleCount()-previous))
+			}
+			data.DataPoints = append(data.DataPoints, point)
+		}
+
+		scope.Metrics = append(scope.Metrics, metric)
+	}
+
+	resourceMetrics := otlpResourceMetrics{ScopeMetrics: []otlpScopeMetrics{scope}}
+	resourceMetrics.Resource.Attributes = otlpAttributes(resource)
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{resourceMetrics}}
+}
+
+// sendOTLP posts the metrics to the OTLP/HTTP endpoint in JSON encoding
+func (p *Pusher) sendOTLP(families []*dto.MetricFamily, now time.Time) error {
+	body, err := json.Marshal(newOTLPRequest(families, p.config.Resource, p.start, now))
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, p.config.OTLPURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "ftl_exporter/"+version.Version)
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := checkResponse(response); err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+
+	return nil
+}
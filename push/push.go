@@ -0,0 +1,231 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package push sends the metrics of the exporter to a Pushgateway,
+// a Prometheus remote_write endpoint, an OpenTelemetry collector or InfluxDB
+// for Pi-holes which cannot be scraped
+package push
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Config of the push loop
+type Config struct {
+	// PushgatewayURL is the address of the Pushgateway, e.g. http://pushgateway:9091
+	PushgatewayURL string
+	// RemoteWriteURL is the remote_write endpoint, e.g. http://prometheus:9090/api/v1/write
+	RemoteWriteURL string
+	// OTLPURL is the OTLP/HTTP metrics endpoint, e.g. http://otel-collector:4318/v1/metrics
+	OTLPURL string
+	// Resource holds the attributes of the OTLP resource, e.g. host.name
+	Resource map[string]string
+	// InfluxURL is the address of InfluxDB v2, e.g. http://influxdb:8086,
+	// the metrics are written into the bucket of the organization
+	InfluxURL    string
+	InfluxOrg    string
+	InfluxBucket string
+	InfluxToken  string
+	// Job and Instance identify the metrics pushed to Prometheus,
+	// Instance is the host tag in InfluxDB
+	Job      string
+	Instance string
+	// Interval between two collections
+	Interval time.Duration
+	// Retries of a failed push, the backoff doubles after every retry
+	Retries      int
+	RetryBackoff time.Duration
+	// BufferSize limits the collections kept for remote_write while it fails
+	BufferSize int
+}
+
+// Enabled reports whether any push target is configured
+func (c Config) Enabled() bool {
+	return c.PushgatewayURL != "" || c.RemoteWriteURL != "" || c.OTLPURL != "" || c.InfluxURL != ""
+}
+
+// errPermanent marks the failures which are not retried
+var errPermanent = errors.New("permanent failure")
+
+// checkResponse returns the status and the start of the body of an
+// unsuccessful response. Client errors except of throttling are
+// permanent, the request would fail again
+func checkResponse(response *http.Response) error {
+	if response.StatusCode/100 == 2 {
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+	err := fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(message)))
+	if response.StatusCode/100 == 4 && response.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %s", errPermanent, err)
+	}
+
+	return err
+}
+
+// Pusher runs the collectors of the gatherer on the interval
+// and sends their results to the configured targets
+type Pusher struct {
+	config   Config
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	// start of the cumulative OTLP sums
+	start time.Time
+
+	// collections not yet accepted by the remote_write endpoint
+	pending []writeRequest
+}
+
+// New creates the pusher of the metrics from the gatherer,
+// a nil client is replaced by the default one
+func New(gatherer prometheus.Gatherer, config Config, client *http.Client) *Pusher {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.BufferSize < 1 {
+		config.BufferSize = 1
+	}
+
+	return &Pusher{
+		config:   config,
+		gatherer: gatherer,
+		client:   client,
+		start:    time.Now(),
+	}
+}
+
+// Run pushes the metrics on every interval until stop is closed.
+// A nil channel keeps pushing forever
+func (p *Pusher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Push(time.Now()); err != nil {
+			log.Println("Failed to push metrics:", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push collects the metrics once and sends them to every target
+func (p *Pusher) Push(now time.Time) error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		// the metrics gathered despite the error are pushed anyway
+		log.Println("Failed to gather metrics for push:", err)
+	}
+
+	var result error
+	if p.config.PushgatewayURL != "" {
+		if err := p.retry(func() error { return p.pushGateway(families) }); err != nil {
+			result = err
+		}
+	}
+
+	if p.config.RemoteWriteURL != "" {
+		if err := p.remoteWrite(families, now); err != nil {
+			result = err
+		}
+	}
+
+	if p.config.OTLPURL != "" {
+		if err := p.retry(func() error { return p.sendOTLP(families, now) }); err != nil {
+			result = err
+		}
+	}
+
+	if p.config.InfluxURL != "" {
+		if err := p.retry(func() error { return p.sendInflux(families, now) }); err != nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// retry runs the push until it succeeds, fails permanently or runs out of retries
+func (p *Pusher) retry(push func() error) error {
+	backoff := p.config.RetryBackoff
+	err := push()
+	for i := 0; i < p.config.Retries && err != nil && !errors.Is(err, errPermanent); i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = push()
+	}
+
+	return err
+}
+
+// pushGateway replaces the metrics of the job and instance on the Pushgateway.
+// Only the latest collection is retried as the Pushgateway keeps no history
+func (p *Pusher) pushGateway(families []*dto.MetricFamily) error {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})
+
+	pusher := push.New(p.config.PushgatewayURL, p.config.Job).
+		Gatherer(gatherer).
+		Client(p.client)
+	if p.config.Instance != "" {
+		pusher = pusher.Grouping("instance", p.config.Instance)
+	}
+
+	return pusher.Push()
+}
+
+// remoteWrite sends the buffered collections together with the new one
+// oldest first. Collections which are not accepted stay in the buffer,
+// the oldest ones are dropped once it is full
+func (p *Pusher) remoteWrite(families []*dto.MetricFamily, now time.Time) error {
+	labels := map[string]string{"job": p.config.Job}
+	if p.config.Instance != "" {
+		labels["instance"] = p.config.Instance
+	}
+
+	p.pending = append(p.pending, newWriteRequest(families, labels, now))
+	if dropped := len(p.pending) - p.config.BufferSize; dropped > 0 {
+		log.Printf("Dropped %d collections buffered for remote_write", dropped)
+		p.pending = p.pending[dropped:]
+	}
+
+	var rejected error
+	for len(p.pending) > 0 {
+		err := p.retry(func() error { return p.send(p.pending[0]) })
+		if err != nil && !errors.Is(err, errPermanent) {
+			return err
+		}
+		// a rejected collection would be rejected again
+		rejected = err
+		p.pending = p.pending[1:]
+	}
+
+	return rejected
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fields splits the protobuf message into its fields
+func fields(t *testing.T, message []byte) (numbers []int, values [][]byte) {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		message = message[n:]
+
+		var value []byte
+		switch key & 7 {
+		case 0:
+			_, n := binary.Uvarint(message)
+			value, message = message[:n], message[n:]
+		case 1:
+			value, message = message[:8], message[8:]
+		case 2:
+			size, n := binary.Uvarint(message)
+			value, message = message[n:n+int(size)], message[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		numbers = append(numbers, int(key>>3))
+		values = append(values, value)
+	}
+
+	return numbers, values
+}
+
+// decodeWriteRequest returns the series of the request as `name{labels} value`
+func decodeWriteRequest(t *testing.T, body []byte) []string {
+	var result []string
+	message, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, series := fields(t, message)
+	for _, ts := range series {
+		var labels []string
+		var value float64
+		numbers, values := fields(t, ts)
+		for i, number := range numbers {
+			_, pair := fields(t, values[i])
+			switch number {
+			case 1:
+				labels = append(labels, string(pair[0])+"="+string(pair[1]))
+			case 2:
+				value = math.Float64frombits(binary.LittleEndian.Uint64(pair[0]))
+			}
+		}
+		result = append(result, strings.Join(labels, ",")+" "+formatFloat(value))
+	}
+
+	return result
+}
+
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newTestServer(failures int) *testServer {
+	s := &testServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests = append(s.requests, r)
+		if s.failures > 0 {
+			s.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+			return
+		}
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	return s
+}
+
+func testRegistry() *prometheus.Registry {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ftl_status", Help: "Blocking status."})
+	gauge.Set(1)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge)
+
+	return registry
+}
+
+func TestPusher_remoteWrite(t *testing.T) {
+	server := newTestServer(2)
+	defer server.Close()
+
+	pusher := New(testRegistry(), Config{
+		RemoteWriteURL: server.URL,
+		Job:            "ftl",
+		Instance:       "pihole",
+		Retries:        1,
+		BufferSize:     5,
+	}, nil)
+
+	// the first collection stays in the buffer after two failures
+	if err := pusher.Push(time.Unix(1000, 0)); err == nil {
+		t.Error("Push() should fail")
+	}
+	if err := pusher.Push(time.Unix(1060, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.requests) != 4 || len(server.bodies) != 2 {
+		t.Fatalf("requests = %d, accepted = %d, want 4 and 2", len(server.requests), len(server.bodies))
+	}
+	if encoding := server.requests[0].Header.Get("Content-Encoding"); encoding != "snappy" {
+		t.Errorf("Content-Encoding = %s", encoding)
+	}
+
+	want := []string{"__name__=ftl_status,instance=pihole,job=ftl 1"}
+	for _, body := range server.bodies {
+		if got := decodeWriteRequest(t, body); !reflect.DeepEqual(got, want) {
+			t.Errorf("series = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPusher_remoteWrite_buffer(t *testing.T) {
+	server := newTestServer(3)
+	defer server.Close()
+
+	pusher := New(testRegistry(), Config{RemoteWriteURL: server.URL, Job: "ftl", BufferSize: 2}, nil)
+	for i := 0; i < 3; i++ {
+		_ = pusher.Push(time.Now())
+	}
+
+	if len(pusher.pending) != 2 {
+		t.Errorf("pending = %d, want 2", len(pusher.pending))
+	}
+
+	if err := pusher.Push(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(pusher.pending) != 0 || len(server.bodies) != 2 {
+		t.Errorf("pending = %d, accepted = %d, want 0 and 2", len(pusher.pending), len(server.bodies))
+	}
+}
+
+func TestPusher_pushgateway(t *testing.T) {
+	server := newTestServer(1)
+	defer server.Close()
+
+	pusher := New(testRegistry(), Config{PushgatewayURL: server.URL, Job: "ftl", Instance: "pihole", Retries: 1}, nil)
+	if err := pusher.Push(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(server.requests))
+	}
+	request := server.requests[1]
+	if request.Method != http.MethodPut || request.URL.Path != "/metrics/job/ftl/instance/pihole" {
+		t.Errorf("request = %s %s", request.Method, request.URL.Path)
+	}
+}
+
+func TestPusher_otlp(t *testing.T) {
+	server := newTestServer(0)
+	defer server.Close()
+
+	registry := testRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ftl_client_command_duration_seconds",
+		Help:    "Round-trip time of FTL commands.",
+		Buckets: []float64{.1, 1},
+	})
+	histogram.Observe(.05)
+	histogram.Observe(.5)
+	histogram.Observe(5)
+	registry.MustRegister(histogram)
+
+	pusher := New(registry, Config{
+		OTLPURL:  server.URL + "/v1/metrics",
+		Resource: map[string]string{"host.name": "pihole", "ftl.version": "v5.2"},
+	}, nil)
+	if err := pusher.Push(time.Unix(1000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.bodies) != 1 || server.requests[0].URL.Path != "/v1/metrics" {
+		t.Fatalf("requests = %d, accepted = %d", len(server.requests), len(server.bodies))
+	}
+
+	var request otlpRequest
+	if err := json.Unmarshal(server.bodies[0], &request); err != nil {
+		t.Fatal(err)
+	}
+
+	resource := request.ResourceMetrics[0].Resource.Attributes
+	if len(resource) != 2 || resource[0].Key != "ftl.version" || resource[1].Value.StringValue != "pihole" {
+		t.Errorf("resource = %+v", resource)
+	}
+
+	metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+
+	duration := metrics[0].Histogram.DataPoints[0]
+	if !reflect.DeepEqual(duration.BucketCounts, []string{"1", "1", "1"}) || duration.Count != "3" {
+		t.Errorf("histogram = %+v", duration)
+	}
+
+	status := metrics[1].Gauge.DataPoints[0]
+	if *status.AsDouble != 1 || status.TimeUnixNano != "1000000000000" {
+		t.Errorf("gauge = %+v", status)
+	}
+}
+
+func TestPusher_influx(t *testing.T) {
+	server := newTestServer(0)
+	defer server.Close()
+
+	pusher := New(testRegistry(), Config{
+		InfluxURL:    server.URL,
+		InfluxOrg:    "home",
+		InfluxBucket: "pihole",
+		InfluxToken:  "secret",
+		Instance:     "pihole",
+	}, nil)
+	if err := pusher.Push(time.Unix(1000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.bodies) != 1 {
+		t.Fatalf("requests = %d, accepted = %d", len(server.requests), len(server.bodies))
+	}
+	request := server.requests[0]
+	if request.URL.Path != "/api/v2/write" || request.URL.Query().Get("bucket") != "pihole" ||
+		request.Header.Get("Authorization") != "Token secret" {
+		t.Errorf("request = %s %s", request.URL, request.Header)
+	}
+	if body := string(server.bodies[0]); body != "ftl_status,host=pihole value=1 1000000000000\n" {
+		t.Errorf("body = %q", body)
+	}
+}
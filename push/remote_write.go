@@ -0,0 +1,181 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/opensrcit/ftl_exporter/version"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+type timeSeries struct {
+	labels  []label
+	samples []sample
+}
+
+// writeRequest is a single collection in terms of the remote_write protocol
+type writeRequest struct {
+	series []timeSeries
+}
+
+// newWriteRequest converts the metric families into time series with the
+// labels added. Summaries and histograms are split into the series
+// of their quantiles or buckets, sum and count like on a scrape
+func newWriteRequest(families []*dto.MetricFamily, labels map[string]string, now time.Time) writeRequest {
+	var request writeRequest
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			timestamp := now.UnixNano() / int64(time.Millisecond)
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+
+			add := func(suffix string, value float64, extra ...label) {
+				series := timeSeries{samples: []sample{{value: value, timestamp: timestamp}}}
+				series.labels = append(series.labels, label{"__name__", family.GetName() + suffix})
+				for name, value := range labels {
+					series.labels = append(series.labels, label{name, value})
+				}
+				for _, pair := range metric.Label {
+					series.labels = append(series.labels, label{pair.GetName(), pair.GetValue()})
+				}
+				series.labels = append(series.labels, extra...)
+				sort.Slice(series.labels, func(i, j int) bool { return series.labels[i].name < series.labels[j].name })
+
+				request.series = append(request.series, series)
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", metric.Counter.GetValue())
+			case dto.MetricType_GAUGE:
+				add("", metric.Gauge.GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", metric.Untyped.GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, quantile := range metric.Summary.Quantile {
+					add("", quantile.GetValue(), label{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				add("_sum", metric.Summary.GetSampleSum())
+				add("_count", float64(metric.Summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				for _, bucket := range metric.Histogram.Bucket {
+					add("_bucket", float64(bucket.GetCumulativeCount()), label{"le", formatFloat(bucket.GetUpperBound())})
+				}
+				add("_bucket", float64(metric.Histogram.GetSampleCount()), label{"le", "+Inf"})
+				add("_sum", metric.Histogram.GetSampleSum())
+				add("_count", float64(metric.Histogram.GetSampleCount()))
+			}
+		}
+	}
+
+	return request
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, +1) {
+		return "+Inf"
+	}
+
+	return fmt.Sprint(value)
+}
+
+// protobuf encodes the fields of the remote_write messages
+type protobuf struct {
+	bytes.Buffer
+}
+
+func (b *protobuf) varint(value uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], value)])
+}
+
+func (b *protobuf) tag(field int, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protobuf) bytesField(field int, value []byte) {
+	b.tag(field, 2)
+	b.varint(uint64(len(value)))
+	b.Write(value)
+}
+
+// marshal encodes the request as prometheus.WriteRequest message
+func (r writeRequest) marshal() []byte {
+	var request protobuf
+	for _, series := range r.series {
+		var ts protobuf
+		for _, l := range series.labels {
+			var message protobuf
+			message.bytesField(1, []byte(l.name))
+			message.bytesField(2, []byte(l.value))
+			ts.bytesField(1, message.Bytes())
+		}
+		for _, s := range series.samples {
+			var message protobuf
+			message.tag(1, 1)
+			_ = binary.Write(&message, binary.LittleEndian, math.Float64bits(s.value))
+			message.tag(2, 0)
+			message.varint(uint64(s.timestamp))
+			ts.bytesField(2, message.Bytes())
+		}
+		request.bytesField(1, ts.Bytes())
+	}
+
+	return request.Bytes()
+}
+
+// send posts the request to the remote_write endpoint
+func (p *Pusher) send(request writeRequest) error {
+	body := snappy.Encode(nil, request.marshal())
+
+	httpRequest, err := http.NewRequest(http.MethodPost, p.config.RemoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Encoding", "snappy")
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	httpRequest.Header.Set("User-Agent", "ftl_exporter/"+version.Version)
+	httpRequest.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	response, err := p.client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := checkResponse(response); err != nil {
+		return fmt.Errorf("remote_write: %w", err)
+	}
+
+	return nil
+}
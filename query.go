@@ -0,0 +1,247 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/collector"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// query is a client call of the `query` command
+type query struct {
+	// method is the name of the client.FTLAPI method, see client.Recorder
+	method string
+	call   func(api client.FTLAPI) (interface{}, error)
+}
+
+// queries maps the names accepted by the `query` command to the client calls
+var queries = map[string]query{
+	"stats":               {"GetStats", func(api client.FTLAPI) (interface{}, error) { return api.GetStats() }},
+	"db-stats":            {"GetDBStats", func(api client.FTLAPI) (interface{}, error) { return api.GetDBStats() }},
+	"top-domains":         {"GetTopDomains", func(api client.FTLAPI) (interface{}, error) { return api.GetTopDomains() }},
+	"top-ads":             {"GetTopAds", func(api client.FTLAPI) (interface{}, error) { return api.GetTopAds() }},
+	"top-clients":         {"GetTopClients", func(api client.FTLAPI) (interface{}, error) { return api.GetTopClients() }},
+	"top-blocked-clients": {"GetTopBlockedClients", func(api client.FTLAPI) (interface{}, error) { return api.GetTopBlockedClients() }},
+	"forward-dest":        {"GetForwardDestinations", func(api client.FTLAPI) (interface{}, error) { return api.GetForwardDestinations() }},
+	"query-types":         {"GetQueryTypes", func(api client.FTLAPI) (interface{}, error) { return api.GetQueryTypes() }},
+	"queries-over-time":   {"GetQueriesOverTime", func(api client.FTLAPI) (interface{}, error) { return api.GetQueriesOverTime() }},
+	"clients-over-time":   {"GetClientsOverTime", func(api client.FTLAPI) (interface{}, error) { return api.GetClientsOverTime() }},
+	"client-names":        {"GetClientNames", func(api client.FTLAPI) (interface{}, error) { return api.GetClientNames() }},
+}
+
+func queryNames() []string {
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// collectorQueries returns the queries run by every collector using FTL
+func collectorQueries() map[string][]string {
+	byMethod := make(map[string]string)
+	for name, q := range queries {
+		byMethod[q.method] = name
+	}
+
+	result := make(map[string][]string)
+	for name, methods := range collector.Methods() {
+		for _, method := range methods {
+			result[name] = append(result[name], byMethod[method])
+		}
+	}
+
+	return result
+}
+
+// runQuery implements the `query` command which prints decoded FTL responses
+func runQuery(args []string) int {
+	names, output, ok := parseQueryArgs(args)
+	if !ok {
+		return 2
+	}
+
+	api, closeAPI, err := newFTLAPI()
+	if err != nil {
+		log.Println(err)
+
+		return 1
+	}
+	defer closeAPI()
+
+	return printQueries(os.Stdout, api, names, output)
+}
+
+// parseQueryArgs returns the query names and the output format of the
+// arguments of the `query` command. The usage is printed if they are invalid
+func parseQueryArgs(args []string) ([]string, string, bool) {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	output := flags.String("output", "table", "Output format: json or table.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] query [--output json|table] <%s>...\n",
+			os.Args[0], strings.Join(queryNames(), "|"))
+		flags.PrintDefaults()
+	}
+
+	// flags are accepted before and after the query names
+	var names []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, "", false
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		names = append(names, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(names) == 0 || (*output != "json" && *output != "table") {
+		flags.Usage()
+
+		return nil, "", false
+	}
+
+	for _, name := range names {
+		if _, ok := queries[name]; !ok {
+			fmt.Fprintln(flags.Output(), "Unknown query:", name)
+			flags.Usage()
+
+			return nil, "", false
+		}
+	}
+
+	return names, *output, true
+}
+
+// printQueries runs the queries and prints their results in the output format
+func printQueries(out io.Writer, api client.FTLAPI, names []string, output string) int {
+	status := 0
+	for _, name := range names {
+		result, err := queries[name].call(api)
+		if err != nil {
+			log.Printf("Query %s failed: %s", name, err)
+			status = 1
+
+			continue
+		}
+
+		if output == "json" {
+			err = printJSON(out, result)
+		} else {
+			err = printTable(out, name, result)
+		}
+		if err != nil {
+			log.Println(err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func printJSON(w io.Writer, result interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(result)
+}
+
+func printTable(out io.Writer, name string, result interface{}) error {
+	fmt.Fprintf(out, "# %s\n", name)
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	switch r := result.(type) {
+	case *client.Stats:
+		fmt.Fprintf(w, "domains being blocked\t%d\n", r.DomainsBeingBlocked)
+		fmt.Fprintf(w, "dns queries today\t%d\n", r.DnsQueriesToday)
+		fmt.Fprintf(w, "ads blocked today\t%d\n", r.AdsBlockedToday)
+		fmt.Fprintf(w, "ads percentage today\t%.2f\n", r.AdsPercentageToday)
+		fmt.Fprintf(w, "unique domains\t%d\n", r.UniqueDomains)
+		fmt.Fprintf(w, "queries forwarded\t%d\n", r.QueriesForwarded)
+		fmt.Fprintf(w, "queries cached\t%d\n", r.QueriesCached)
+		fmt.Fprintf(w, "clients ever seen\t%d\n", r.ClientsEverSeen)
+		fmt.Fprintf(w, "unique clients\t%d\n", r.UniqueClients)
+		fmt.Fprintf(w, "status\t%d\n", r.Status)
+	case *client.DBStats:
+		fmt.Fprintf(w, "queries in database\t%d\n", r.Rows.Value)
+		fmt.Fprintf(w, "database file size\t%d\n", r.Size.Value)
+	case *client.Entries:
+		fmt.Fprintf(w, "TOTAL\t%d\n", r.Total.Value)
+		fmt.Fprintln(w, "ENTRY\tCOUNT")
+		for _, entry := range r.List {
+			fmt.Fprintf(w, "%s\t%d\n", entry.Entry, entry.Count)
+		}
+	case *[]client.UpstreamDestination:
+		fmt.Fprintln(w, "NAME\tADDRESS\tPERCENTAGE")
+		for _, destination := range *r {
+			fmt.Fprintf(w, "%s\t%s\t%.2f\n", destination.Name, destination.Address, destination.Percentage)
+		}
+	case *map[string]float32:
+		types := make([]string, 0, len(*r))
+		for queryType := range *r {
+			types = append(types, queryType)
+		}
+		sort.Strings(types)
+
+		fmt.Fprintln(w, "TYPE\tPERCENTAGE")
+		for _, queryType := range types {
+			fmt.Fprintf(w, "%s\t%.2f\n", queryType, (*r)[queryType])
+		}
+	case *client.OverTime:
+		blocked := make(map[uint32]uint32)
+		for _, slot := range r.Blocked {
+			blocked[slot.Timestamp.Value] = slot.Count.Value
+		}
+
+		fmt.Fprintln(w, "TIME\tTOTAL\tBLOCKED")
+		for _, slot := range r.Forwarded {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", formatTimestamp(slot.Timestamp.Value), slot.Count.Value, blocked[slot.Timestamp.Value])
+		}
+	case *[]client.TimestampClients:
+		fmt.Fprintln(w, "TIME\tCOUNTS")
+		for _, slot := range *r {
+			counts := make([]string, len(slot.Count))
+			for i, count := range slot.Count {
+				counts[i] = fmt.Sprint(count.Value)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", formatTimestamp(slot.Timestamp), strings.Join(counts, " "))
+		}
+	case *[]client.Client:
+		fmt.Fprintln(w, "NAME\tADDRESS")
+		for _, c := range *r {
+			fmt.Fprintf(w, "%s\t%s\n", c.Name, c.Address)
+		}
+	default:
+		return fmt.Errorf("no table format for %T", result)
+	}
+
+	return w.Flush()
+}
+
+func formatTimestamp(timestamp uint32) string {
+	return time.Unix(int64(timestamp), 0).Format(time.RFC3339)
+}
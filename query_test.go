@@ -0,0 +1,164 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/opensrcit/ftl_exporter/ftltest"
+)
+
+func TestParseQueryArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		names  []string
+		output string
+		ok     bool
+	}{
+		{name: "single query", args: []string{"stats"}, names: []string{"stats"}, output: "table", ok: true},
+		{name: "output before names", args: []string{"--output", "json", "stats", "top-ads"}, names: []string{"stats", "top-ads"}, output: "json", ok: true},
+		{name: "output after names", args: []string{"stats", "--output=json"}, names: []string{"stats"}, output: "json", ok: true},
+		{name: "no query", args: nil},
+		{name: "unknown query", args: []string{"stats", "version"}},
+		{name: "unknown output", args: []string{"--output", "yaml", "stats"}},
+		{name: "unknown flag", args: []string{"--format", "json", "stats"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, output, ok := parseQueryArgs(tt.args)
+			if ok != tt.ok || !reflect.DeepEqual(names, tt.names) || output != tt.output {
+				t.Errorf("parseQueryArgs() got = %v, %q, %v, want %v, %q, %v", names, output, ok, tt.names, tt.output, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPrintQueries(t *testing.T) {
+	tests := []struct {
+		name   string
+		names  []string
+		output string
+		want   string
+		status int
+	}{
+		{
+			name:   "stats table",
+			names:  []string{"stats"},
+			output: "table",
+			want: `# stats
+domains being blocked  94821
+dns queries today      3214
+ads blocked today      25
+ads percentage today   0.50
+unique domains         3679
+queries forwarded      435
+queries cached         2754
+clients ever seen      7
+unique clients         5
+status                 1
+`,
+		},
+		{
+			name:   "entries and destinations table",
+			names:  []string{"top-domains", "forward-dest", "query-types", "client-names"},
+			output: "table",
+			want: `# top-domains
+TOTAL        3214
+ENTRY        COUNT
+example.com  300
+example.org  200
+# forward-dest
+NAME        ADDRESS  PERCENTAGE
+cache       cache    85.50
+dns.google  8.8.8.8  14.50
+# query-types
+TYPE         PERCENTAGE
+A (IPv4)     75.00
+AAAA (IPv6)  25.00
+# client-names
+NAME    ADDRESS
+laptop  192.168.1.2
+`,
+		},
+		{
+			name:   "json",
+			names:  []string{"forward-dest"},
+			output: "json",
+			want: `[
+  {
+    "Name": "cache",
+    "Address": "cache",
+    "Percentage": 85.5
+  },
+  {
+    "Name": "dns.google",
+    "Address": "8.8.8.8",
+    "Percentage": 14.5
+  }
+]
+`,
+		},
+		{
+			name:   "failed query",
+			names:  []string{"db-stats", "top-ads"},
+			output: "table",
+			want: `# top-ads
+TOTAL            25
+ENTRY            COUNT
+ads.example.com  20
+`,
+			status: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := ftltest.Fake()
+			fake.DBStats = nil
+
+			var out bytes.Buffer
+			if status := printQueries(&out, fake, tt.names, tt.output); status != tt.status {
+				t.Errorf("printQueries() status = %d, want %d", status, tt.status)
+			}
+			if out.String() != tt.want {
+				t.Errorf("printQueries() got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectorQueries(t *testing.T) {
+	collectors := collectorQueries()
+
+	want := map[string][]string{
+		"clients":           {"top-clients", "top-blocked-clients"},
+		"clients_over_time": {"clients-over-time", "client-names"},
+		"stats":             {"stats"},
+	}
+	for name, queries := range want {
+		if !reflect.DeepEqual(collectors[name], queries) {
+			t.Errorf("collectorQueries()[%s] = %v, want %v", name, collectors[name], queries)
+		}
+	}
+
+	for name, names := range collectors {
+		for _, query := range names {
+			if _, ok := queries[query]; !ok {
+				t.Errorf("%s collector calls a method without query: %v", name, names)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build replay
+// +build replay
+
+package main
+
+import (
+	"log"
+
+	"github.com/opensrcit/ftl_exporter/ftltest"
+)
+
+// startReplay serves the recorded responses in the directory on a socket
+// in the temporary directory. The returned function stops the server
+// and removes the socket
+func startReplay(dir string) (string, func(), error) {
+	server, err := ftltest.NewUnixServer()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := server.LoadFixtures(dir); err != nil {
+		server.Close()
+
+		return "", nil, err
+	}
+
+	return server.Addr(), func() {
+		if err := server.Close(); err != nil {
+			log.Println("Failed to stop replay server:", err)
+		}
+	}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/collector"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// snapshotPath serves the results of the last collection as JSON,
+// the results of a single collector are served under its name
+const snapshotPath = "/api/v1/snapshot"
+
+// snapshotEntry is the last result of a query
+type snapshotEntry struct {
+	Time     time.Time   `json:"time"`
+	Duration float64     `json:"duration_seconds"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// snapshotHandler serves the results recorded during collections
+type snapshotHandler struct {
+	recorder *client.Recorder
+}
+
+// ServeHTTP implements http.Handler.
+func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	names := queryNames()
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, snapshotPath), "/")
+	if name != "" {
+		enabled, exist := collector.States()[name]
+		if !exist || !enabled {
+			http.Error(w, "Unknown or disabled collector: "+name, http.StatusNotFound)
+
+			return
+		}
+		names = collectorQueries()[name]
+		if len(names) == 0 {
+			http.Error(w, "collector has no FTL queries: "+name, http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	snapshot := make(map[string]snapshotEntry)
+	for _, query := range names {
+		call, ok := h.recorder.Last(queries[query].method)
+		if !ok {
+			continue
+		}
+
+		entry := snapshotEntry{
+			Time:     call.Time,
+			Duration: call.Duration.Seconds(),
+		}
+		if call.Err != nil {
+			entry.Error = call.Err.Error()
+		} else {
+			entry.Result = call.Result
+		}
+		snapshot[query] = entry
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		log.Println("Failed to write snapshot:", err)
+	}
+}
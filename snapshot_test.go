@@ -0,0 +1,110 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/opensrcit/ftl_exporter/client"
+	"github.com/opensrcit/ftl_exporter/ftltest"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	fake := ftltest.Fake()
+	fake.TopBlockedClients = nil
+	recorder := client.NewRecorder(fake)
+	if _, err := recorder.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.GetTopClients(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.GetTopBlockedClients(); err == nil {
+		t.Fatal("GetTopBlockedClients() should fail")
+	}
+
+	handler := &snapshotHandler{recorder: recorder}
+
+	// the dhcp collector reads the lease file only
+	if err := flag.Set("collector.dhcp", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Set("collector.dhcp", "false")
+
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		queries []string
+	}{
+		{name: "all", path: snapshotPath, status: http.StatusOK, queries: []string{"stats", "top-blocked-clients", "top-clients"}},
+		{name: "collector", path: snapshotPath + "/clients", status: http.StatusOK, queries: []string{"top-blocked-clients", "top-clients"}},
+		{name: "collector without calls", path: snapshotPath + "/domains", status: http.StatusOK, queries: []string{}},
+		{name: "collector without FTL queries", path: snapshotPath + "/dhcp", status: http.StatusBadRequest},
+		{name: "disabled collector", path: snapshotPath + "/db_stats", status: http.StatusNotFound},
+		{name: "unknown collector", path: snapshotPath + "/unknown", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var snapshot map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for query := range snapshot {
+				got = append(got, query)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.queries) {
+				t.Errorf("snapshot queries = %v, want %v", got, tt.queries)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, snapshotPath+"/clients", nil))
+	var snapshot map[string]struct {
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(fake.TopClients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(snapshot["top-clients"].Result) != string(want) {
+		t.Errorf("top-clients result = %s, want %s", snapshot["top-clients"].Result, want)
+	}
+	if snapshot["top-blocked-clients"].Error != client.ErrNoResponse.Error() {
+		t.Errorf("top-blocked-clients error = %q, want %q", snapshot["top-blocked-clients"].Error, client.ErrNoResponse)
+	}
+}
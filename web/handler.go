@@ -0,0 +1,142 @@
+// Copyright 2020 The Prometheus Authors
+// Modifications copyright 2020 Ivan Pushkin
+//
+// Adapted from github.com/prometheus/exporter-toolkit/web, see NOTICE.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ValidateConfig checks the web configuration file for errors
+func ValidateConfig(configPath string) error {
+	c, err := getConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range c.Users {
+		if _, err := bcrypt.Cost([]byte(p)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ConfigToTLSConfig(&c.TLSConfig); err != nil && err != errNoTLSConfig {
+		return err
+	}
+
+	return nil
+}
+
+// webHandler checks basic authentication credentials before passing
+// the request to the wrapped handler
+type webHandler struct {
+	handler    http.Handler
+	configPath string
+
+	// cache stores the results of the bcrypt comparisons
+	// as they are slow by design
+	cache *cache
+}
+
+func (u *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := getConfig(u.configPath)
+	if err != nil {
+		log.Printf("Unable to parse configuration: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	if len(c.Users) == 0 {
+		u.handler.ServeHTTP(w, r)
+
+		return
+	}
+
+	user, pass, auth := r.BasicAuth()
+	if auth {
+		hashedPassword, validUser := c.Users[user]
+		if !validUser {
+			// The user is not found. Use a fixed password hash to
+			// prevent user enumeration by timing requests.
+			// This is a bcrypt-hashed version of "fakepassword".
+			hashedPassword = "$2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi"
+		}
+
+		hash := sha256.Sum256([]byte(user + string(hashedPassword) + pass))
+		cacheKey := hex.EncodeToString(hash[:])
+		authOk, ok := u.cache.get(cacheKey)
+		if !ok {
+			err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(pass))
+			authOk = validUser && err == nil
+			u.cache.set(cacheKey, authOk)
+		}
+
+		if authOk && validUser {
+			u.handler.ServeHTTP(w, r)
+
+			return
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", "FTL Exporter"))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+const maxCacheSize = 100
+
+// cache is a size limited map of authentication results
+type cache struct {
+	sync.Mutex
+	entries map[string]bool
+}
+
+func newCache() *cache {
+	return &cache{
+		entries: make(map[string]bool),
+	}
+}
+
+func (c *cache) get(key string) (bool, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	v, ok := c.entries[key]
+
+	return v, ok
+}
+
+func (c *cache) set(key string, value bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.entries) >= maxCacheSize {
+		for k := range c.entries {
+			delete(c.entries, k)
+
+			break
+		}
+	}
+	c.entries[key] = value
+}
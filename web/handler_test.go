@@ -0,0 +1,249 @@
+// Copyright 2020 Ivan Pushkin
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "web_config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "web.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key as server.crt and server.key into the directory of the config
+func writeCertificate(t *testing.T, configPath string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ftl_exporter"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Dir(configPath)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, "basic_auth_users:\n  prometheus: "+string(hash)+"\n")
+
+	if err := ValidateConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &webHandler{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		configPath: path,
+		cache:      newCache(),
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		auth     bool
+		want     int
+	}{
+		{name: "no credentials", want: http.StatusUnauthorized},
+		{name: "valid credentials", user: "prometheus", password: "secret", auth: true, want: http.StatusOK},
+		{name: "wrong password", user: "prometheus", password: "wrong", auth: true, want: http.StatusUnauthorized},
+		{name: "unknown user", user: "grafana", password: "secret", auth: true, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.auth {
+				r.SetBasicAuth(tt.user, tt.password)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("ServeHTTP() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "unknown field", content: "tls_server_config:\n  cert: foo\n", want: "field cert not found"},
+		{name: "missing key", content: "tls_server_config:\n  cert_file: server.crt\n", want: "missing key_file"},
+		{name: "invalid client auth", content: "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: Sometimes\n", want: "invalid client_auth_type"},
+		{name: "invalid hash", content: "basic_auth_users:\n  prometheus: plaintext\n", want: "hashedSecret too short"},
+		{name: "unknown TLS version", content: "tls_server_config:\n  min_version: TLS99\n", want: "unknown TLS version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			writeCertificate(t, path)
+
+			err := ValidateConfig(path)
+			if err == nil {
+				t.Fatal("ValidateConfig() should fail")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateConfig() error = %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n"+
+		"basic_auth_users:\n  prometheus: "+string(hash)+"\n")
+	cert := writeCertificate(t, path)
+
+	if err := ValidateConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(server.Listener, server.Config, path)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		Timeout:   5 * time.Second,
+	}
+	url := "https://" + server.Listener.Addr().String() + "/metrics"
+
+	tests := []struct {
+		name string
+		auth bool
+		want int
+	}{
+		{name: "no credentials", want: http.StatusUnauthorized},
+		{name: "valid credentials", auth: true, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.auth {
+				r.SetBasicAuth("prometheus", "secret")
+			}
+
+			response, err := httpClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+
+			if response.TLS == nil {
+				t.Error("response should be served over TLS")
+			}
+			if response.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.want)
+			}
+		})
+	}
+
+	plain, err := http.Get("http://" + server.Listener.Addr().String() + "/metrics")
+	if err == nil {
+		plain.Body.Close()
+		if plain.StatusCode == http.StatusOK {
+			t.Error("plain HTTP request should not be served")
+		}
+	}
+
+	server.Config.Close()
+	if err := <-done; err != http.ErrServerClosed {
+		t.Errorf("Serve() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
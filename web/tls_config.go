@@ -0,0 +1,327 @@
+// Copyright 2020 The Prometheus Authors
+// Modifications copyright 2020 Ivan Pushkin
+//
+// Adapted from github.com/prometheus/exporter-toolkit/web, see NOTICE.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+var errNoTLSConfig = errors.New("TLS config is not present")
+
+// Config represents the web configuration file. The format is compatible
+// with the one of the Prometheus exporter-toolkit
+type Config struct {
+	TLSConfig  TLSStruct         `yaml:"tls_server_config"`
+	HTTPConfig HTTPStruct        `yaml:"http_server_config"`
+	Users      map[string]secret `yaml:"basic_auth_users"`
+}
+
+// TLSStruct represents the `tls_server_config` section
+type TLSStruct struct {
+	TLSCertPath              string     `yaml:"cert_file"`
+	TLSKeyPath               string     `yaml:"key_file"`
+	ClientAuth               string     `yaml:"client_auth_type"`
+	ClientCAs                string     `yaml:"client_ca_file"`
+	CipherSuites             []cipher   `yaml:"cipher_suites"`
+	CurvePreferences         []curve    `yaml:"curve_preferences"`
+	MinVersion               tlsVersion `yaml:"min_version"`
+	MaxVersion               tlsVersion `yaml:"max_version"`
+	PreferServerCipherSuites bool       `yaml:"prefer_server_cipher_suites"`
+}
+
+// HTTPStruct represents the `http_server_config` section
+type HTTPStruct struct {
+	HTTP2 bool `yaml:"http2"`
+}
+
+// secret is a password hash which is never printed
+type secret string
+
+func (s secret) MarshalYAML() (interface{}, error) {
+	if s != "" {
+		return "<secret>", nil
+	}
+
+	return nil, nil
+}
+
+// setDirectory joins relative file paths with dir
+func (t *TLSStruct) setDirectory(dir string) {
+	t.TLSCertPath = joinDir(dir, t.TLSCertPath)
+	t.TLSKeyPath = joinDir(dir, t.TLSKeyPath)
+	t.ClientCAs = joinDir(dir, t.ClientCAs)
+}
+
+func joinDir(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+// getConfig reads and validates the web configuration file
+func getConfig(configPath string) (*Config, error) {
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{
+		TLSConfig: TLSStruct{
+			MinVersion:               tls.VersionTLS12,
+			MaxVersion:               tls.VersionTLS13,
+			PreferServerCipherSuites: true,
+		},
+		HTTPConfig: HTTPStruct{HTTP2: true},
+	}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, err
+	}
+	c.TLSConfig.setDirectory(filepath.Dir(configPath))
+
+	return c, nil
+}
+
+// ConfigToTLSConfig builds tls.Config out of the `tls_server_config` section
+func ConfigToTLSConfig(c *TLSStruct) (*tls.Config, error) {
+	if c.TLSCertPath == "" && c.TLSKeyPath == "" && c.ClientAuth == "" && c.ClientCAs == "" {
+		return nil, errNoTLSConfig
+	}
+
+	if c.TLSCertPath == "" {
+		return nil, errors.New("missing cert_file")
+	}
+
+	if c.TLSKeyPath == "" {
+		return nil, errors.New("missing key_file")
+	}
+
+	loadCert := func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertPath, c.TLSKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load X509KeyPair: %w", err)
+		}
+
+		return &cert, nil
+	}
+
+	// Confirm that certificate and key paths are valid.
+	if _, err := loadCert(); err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:               uint16(c.MinVersion),
+		MaxVersion:               uint16(c.MaxVersion),
+		PreferServerCipherSuites: c.PreferServerCipherSuites,
+	}
+
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return loadCert()
+	}
+
+	for _, cs := range c.CipherSuites {
+		cfg.CipherSuites = append(cfg.CipherSuites, uint16(cs))
+	}
+
+	for _, cp := range c.CurvePreferences {
+		cfg.CurvePreferences = append(cfg.CurvePreferences, tls.CurveID(cp))
+	}
+
+	if c.ClientCAs != "" {
+		clientCAPool := x509.NewCertPool()
+		clientCAFile, err := ioutil.ReadFile(c.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		if !clientCAPool.AppendCertsFromPEM(clientCAFile) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAs)
+		}
+		cfg.ClientCAs = clientCAPool
+	}
+
+	switch c.ClientAuth {
+	case "RequestClientCert":
+		cfg.ClientAuth = tls.RequestClientCert
+	case "RequireAnyClientCert", "RequireClientCert": // Preserved for backwards compatibility.
+		cfg.ClientAuth = tls.RequireAnyClientCert
+	case "VerifyClientCertIfGiven":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "RequireAndVerifyClientCert":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case "", "NoClientCert":
+		cfg.ClientAuth = tls.NoClientCert
+	default:
+		return nil, fmt.Errorf("invalid client_auth_type: %s", c.ClientAuth)
+	}
+
+	if c.ClientCAs != "" && cfg.ClientAuth == tls.NoClientCert {
+		return nil, errors.New("client CA's have been configured without a client_auth_type")
+	}
+
+	return cfg, nil
+}
+
+// ListenAndServe starts the server on its address. The web configuration
+// file at configPath enables TLS and basic authentication, an empty path
+// starts a plain HTTP server
+func ListenAndServe(server *http.Server, configPath string) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	return Serve(listener, server, configPath)
+}
+
+// Serve starts the server on the given listener, see ListenAndServe
+func Serve(l net.Listener, server *http.Server, configPath string) error {
+	if configPath == "" {
+		log.Println("TLS is disabled.")
+
+		return server.Serve(l)
+	}
+
+	c, err := getConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	handler := server.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = &webHandler{
+		handler:    handler,
+		configPath: configPath,
+		cache:      newCache(),
+	}
+
+	config, err := ConfigToTLSConfig(&c.TLSConfig)
+	switch err {
+	case nil:
+		if !c.HTTPConfig.HTTP2 {
+			server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+		log.Println("TLS is enabled.")
+	case errNoTLSConfig:
+		log.Println("TLS is disabled.")
+
+		return server.Serve(l)
+	default:
+		return err
+	}
+
+	// Reload the configuration on every new connection, so that
+	// the certificates could be renewed without a restart.
+	server.TLSConfig = config
+	server.TLSConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c, err := getConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+
+		config, err := ConfigToTLSConfig(&c.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return config, nil
+	}
+
+	return server.ServeTLS(l, "", "")
+}
+
+type cipher uint16
+
+func (c *cipher) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == s {
+			*c = cipher(cs.ID)
+
+			return nil
+		}
+	}
+
+	return errors.New("unknown cipher: " + s)
+}
+
+type curve tls.CurveID
+
+var curves = map[string]curve{
+	"CurveP256": (curve)(tls.CurveP256),
+	"CurveP384": (curve)(tls.CurveP384),
+	"CurveP521": (curve)(tls.CurveP521),
+	"X25519":    (curve)(tls.X25519),
+}
+
+func (c *curve) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	if curveID, ok := curves[s]; ok {
+		*c = curveID
+
+		return nil
+	}
+
+	return errors.New("unknown curve: " + s)
+}
+
+type tlsVersion uint16
+
+var tlsVersions = map[string]tlsVersion{
+	"TLS13": (tlsVersion)(tls.VersionTLS13),
+	"TLS12": (tlsVersion)(tls.VersionTLS12),
+	"TLS11": (tlsVersion)(tls.VersionTLS11),
+	"TLS10": (tlsVersion)(tls.VersionTLS10),
+}
+
+func (tv *tlsVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	if v, ok := tlsVersions[s]; ok {
+		*tv = v
+
+		return nil
+	}
+
+	return errors.New("unknown TLS version: " + s)
+}